@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// colorModes lists the accepted values of -color.
+var colorModes = []string{"auto", "always", "never"}
+
+// colorEnabled tells whether to use colors with the given options. In the auto
+// mode, colors are only used when the text report goes to a terminal, and
+// NO_COLOR is not set.
+func colorEnabled(opts Options) bool {
+	switch opts.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" || opts.OutputFile != "" || opts.Format != "text" {
+		return false
+	}
+
+	return isTerminal(os.Stderr)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps the text in the color if colors are enabled. Only the text
+// format is ever colored, the machine-readable ones are left intact.
+func (o Options) colorize(text, color string) string {
+	if !o.useColor {
+		return text
+	}
+
+	return paint(text, color)
+}
+
+func paint(text, color string) string {
+	return color + text + ansiReset
+}
+
+// colorLogWriter colors the log messages reporting warnings and probable typos
+// in annotations, which are printed by the library as plain text. It is only
+// used when colors are enabled.
+type colorLogWriter struct {
+	w io.Writer
+}
+
+func (c colorLogWriter) Write(p []byte) (int, error) {
+	line, newline := strings.CutSuffix(string(p), "\n")
+	message := strings.TrimPrefix(line, logPrefix)
+
+	switch {
+	case strings.HasPrefix(message, "error"):
+		line = paint(line, ansiRed)
+	case strings.HasPrefix(message, "warning") || strings.HasPrefix(message, "probably a typo"):
+		line = paint(line, ansiYellow)
+	}
+
+	if newline {
+		line += "\n"
+	}
+
+	if _, err := io.WriteString(c.w, line); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
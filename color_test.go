@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestWriteTextColor(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeText(&buf, testReport, Options{useColor: true}); err != nil {
+		t.Fatalf("writeText failed: %v", err)
+	}
+
+	expected := "go-escape-lint: \x1b[31mvariable at main.go:10 is marked as no-escape (hot path) but escapes to heap\x1b[0m\n" +
+		"go-escape-lint:     x := 42 //no-escape: hot path\n" +
+		"go-escape-lint: \x1b[33mwarning: annotation at main.go:20 matched no compiler output; is it stale?\x1b[0m\n" +
+		"go-escape-lint: \x1b[31m1 failure across 1 file (3 annotations checked, 1 matched no compiler hints)\x1b[0m\n"
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
+
+func TestColorLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := log.New(colorLogWriter{w: &buf}, logPrefix, 0)
+	logger.Printf("warning: annotation at main.go:4 matched no compiler output")
+	logger.Printf("probably a typo '//no-escpae' at main.go:5")
+	logger.Printf("error: unknown output format: yaml")
+	logger.Printf("installed pre-commit hook")
+
+	expected := "\x1b[33mgo-escape-lint: warning: annotation at main.go:4 matched no compiler output\x1b[0m\n" +
+		"\x1b[33mgo-escape-lint: probably a typo '//no-escpae' at main.go:5\x1b[0m\n" +
+		"\x1b[31mgo-escape-lint: error: unknown output format: yaml\x1b[0m\n" +
+		"go-escape-lint: installed pre-commit hook\n"
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		expected bool
+	}{
+		{Options{Color: "always", Format: "json"}, true},
+		{Options{Color: "never", Format: "text"}, false},
+		{Options{Color: "auto", Format: "json"}, false},
+		{Options{Color: "auto", Format: "text", OutputFile: "report.txt"}, false},
+	}
+
+	for _, test := range tests {
+		if enabled := colorEnabled(test.opts); enabled != test.expected {
+			t.Errorf("expected %t for %+v, got %t", test.expected, test.opts, enabled)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const configFileName = ".escape-lint.yml"
+
+type configEntry struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// readConfig reads a configuration file written in a small subset of YAML,
+// where each line is a "key: value" pair. Blank lines and comments starting
+// with "#" are ignored, and values may be quoted.
+func readConfig(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNum)
+		}
+
+		value, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		entries = append(entries, configEntry{
+			Key:   strings.TrimSpace(key),
+			Value: value,
+			Line:  lineNum,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseConfigValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string: %s", value)
+		}
+
+		return value[1 : len(value)-1], nil
+	}
+
+	if i := strings.Index(value, " #"); i != -1 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	return value, nil
+}
+
+// applyConfigFile sets the flags that were not given explicitly on the command
+// line from the configuration file. A missing file is not an error. All unknown
+// keys and invalid values are reported at once.
+func applyConfigFile(flags *flag.FlagSet, path string, explicit map[string]bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open config: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	entries, err := readConfig(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var errs []error
+
+	for _, entry := range entries {
+		if flags.Lookup(entry.Key) == nil {
+			errs = append(errs, fmt.Errorf("%s:%d: unknown key %q", path, entry.Line, entry.Key))
+			continue
+		}
+
+		if explicit[entry.Key] {
+			continue
+		}
+
+		if err := flags.Set(entry.Key, entry.Value); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: invalid value for %s: %w", path, entry.Line, entry.Key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// envPrefix starts the names of the environment variables setting the flags.
+const envPrefix = "ESCAPE_LINT_"
+
+// envName returns the name of the environment variable setting the flag, e.g.
+// ESCAPE_LINT_NO_FAIL for -no-fail.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets the flags that were not given explicitly on the command line
+// from the environment, and marks them as explicit, so that they take precedence
+// over the configuration file. Empty variables are ignored, since CI templates
+// often define them regardless. All invalid values are reported at once.
+func applyEnv(flags *flag.FlagSet, lookupEnv func(string) (string, bool), explicit map[string]bool) error {
+	var errs []error
+
+	flags.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+
+		name := envName(f.Name)
+
+		value, ok := lookupEnv(name)
+		if !ok || value == "" {
+			return
+		}
+
+		if err := flags.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value for %s: %w", name, f.Name, err))
+			return
+		}
+
+		explicit[f.Name] = true
+	})
+
+	return errors.Join(errs...)
+}
+
+// effectiveConfig returns the values of all flags, keyed by their names as in
+// the configuration file, after the file, the environment and the command line
+// are applied.
+func effectiveConfig(flags *flag.FlagSet) map[string]any {
+	config := make(map[string]any)
+
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "print-config" {
+			return
+		}
+
+		if getter, ok := f.Value.(flag.Getter); ok {
+			config[f.Name] = getter.Get()
+		} else {
+			config[f.Name] = f.Value.String()
+		}
+	})
+
+	return config
+}
+
+// printConfig writes the effective configuration as a JSON object, with the
+// keys sorted, so that the configurations of two environments can be diffed.
+func printConfig(w io.Writer, opts Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(opts.config)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	config := `
+# defaults for CI
+strict: true
+input-format: json # trailing comment
+f: "build output.log"
+diff: '-'
+`
+
+	entries, err := readConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("readConfig failed: %v", err)
+	}
+
+	expected := []configEntry{
+		{Key: "strict", Value: "true", Line: 3},
+		{Key: "input-format", Value: "json", Line: 4},
+		{Key: "f", Value: "build output.log", Line: 5},
+		{Key: "diff", Value: "-", Line: 6},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v, got %v", expected, entries)
+	}
+}
+
+func TestReadConfigMalformed(t *testing.T) {
+	if _, err := readConfig(strings.NewReader("strict\n")); err == nil {
+		t.Errorf("expected an error for a line without a colon")
+	}
+}
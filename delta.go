@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+// findingKey identifies a finding across runs. The line number is left out, so
+// that a finding is still matched after unrelated lines were added above it.
+type findingKey struct {
+	File       string
+	Annotation string
+	Message    string
+	Snippet    string
+}
+
+func keyOf(finding jsonFinding) findingKey {
+	return findingKey{
+		File:       finding.File,
+		Annotation: finding.Annotation,
+		Message:    finding.Message,
+		Snippet:    finding.Snippet,
+	}
+}
+
+// reportDelta is the difference between the findings of two runs.
+type reportDelta struct {
+	Added     []jsonFinding // found only in the current run
+	Removed   []jsonFinding // found only in the previous run
+	Unchanged []jsonFinding // found in both runs, as reported by the current one
+}
+
+// newErrors returns the number of added findings with the error severity.
+func (d reportDelta) newErrors() int {
+	n := 0
+
+	for _, finding := range d.Added {
+		if finding.Severity == string(escapelint.SeverityError) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// readJSONReport reads a report written with -format json.
+func readJSONReport(filePath string) (jsonReport, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return jsonReport{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return jsonReport{}, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+
+	return report, nil
+}
+
+// compareReports matches the current findings against the previous ones. Equal
+// findings are matched one to one, so a finding repeated more often than before
+// counts as added.
+func compareReports(previous, current []jsonFinding) reportDelta {
+	remaining := make(map[findingKey]int)
+	for _, finding := range previous {
+		remaining[keyOf(finding)]++
+	}
+
+	var delta reportDelta
+
+	for _, finding := range current {
+		key := keyOf(finding)
+
+		if remaining[key] > 0 {
+			remaining[key]--
+			delta.Unchanged = append(delta.Unchanged, finding)
+		} else {
+			delta.Added = append(delta.Added, finding)
+		}
+	}
+
+	for _, finding := range previous {
+		key := keyOf(finding)
+
+		if remaining[key] > 0 {
+			remaining[key]--
+			delta.Removed = append(delta.Removed, finding)
+		}
+	}
+
+	return delta
+}
+
+// writeDelta writes the added and removed findings, followed by a summary. The
+// unchanged findings are already part of the report, so they are only counted.
+func writeDelta(w io.Writer, delta reportDelta, previousPath string) error {
+	for _, set := range []struct {
+		label    string
+		findings []jsonFinding
+	}{
+		{"new", delta.Added},
+		{"fixed", delta.Removed},
+	} {
+		for _, finding := range set.findings {
+			_, err := fmt.Fprintf(w, "%s%s: %s:%d: %s\n", logPrefix, set.label, finding.File, finding.Line, finding.Message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s%d new, %d fixed, %d unchanged compared to %s\n", logPrefix,
+		len(delta.Added), len(delta.Removed), len(delta.Unchanged), previousPath)
+
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareReports(t *testing.T) {
+	before := []jsonFinding{
+		{File: "main.go", Line: 10, Annotation: "no-escape", Severity: "error", Message: "variable is marked as no-escape but escapes to heap", Snippet: "x := 42 //no-escape"},
+		{File: "main.go", Line: 20, Annotation: "must-inline", Severity: "error", Message: "function is marked as must-inline but is not inlined", Snippet: "foo() //must-inline"},
+	}
+
+	// A line was inserted at the top of the file, one finding was fixed and
+	// another one was introduced.
+	after := []jsonFinding{
+		{File: "main.go", Line: 11, Annotation: "no-escape", Severity: "error", Message: "variable is marked as no-escape but escapes to heap", Snippet: "x := 42 //no-escape"},
+		{File: "main.go", Line: 31, Annotation: "no-escape", Severity: "error", Message: "variable is marked as no-escape but escapes to heap", Snippet: "y := 1 //no-escape"},
+		{File: "main.go", Line: 40, Annotation: "no-inline", Severity: "warning", Message: "annotation matched no compiler output; is it stale?"},
+	}
+
+	delta := compareReports(before, after)
+
+	expected := reportDelta{
+		Added:     after[1:],
+		Removed:   before[1:],
+		Unchanged: after[:1],
+	}
+
+	if !reflect.DeepEqual(delta, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, delta)
+	}
+
+	if n := delta.newErrors(); n != 1 {
+		t.Errorf("expected 1 new error, got %d", n)
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeDelta(&buf, delta, "before.json"); err != nil {
+		t.Fatalf("writeDelta failed: %v", err)
+	}
+
+	expectedOutput := `go-escape-lint: new: main.go:31: variable is marked as no-escape but escapes to heap
+go-escape-lint: new: main.go:40: annotation matched no compiler output; is it stale?
+go-escape-lint: fixed: main.go:20: function is marked as must-inline but is not inlined
+go-escape-lint: 2 new, 1 fixed, 1 unchanged compared to before.json
+`
+
+	if buf.String() != expectedOutput {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedOutput, buf.String())
+	}
+}
+
+func TestReadJSONReport(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "report.json")
+
+	if err := writeReportFile(filePath, testReport, Options{Format: "json"}); err != nil {
+		t.Fatalf("writeReportFile failed: %v", err)
+	}
+
+	report, err := readJSONReport(filePath)
+	if err != nil {
+		t.Fatalf("readJSONReport failed: %v", err)
+	}
+
+	if delta := compareReports(report.Findings, newJSONReport(testReport, false).Findings); len(delta.Added) != 0 || len(delta.Removed) != 0 {
+		t.Errorf("expected no changes after a round trip, got %+v", delta)
+	}
+
+	if err := os.WriteFile(filePath, []byte("go-escape-lint: 0 failures\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := readJSONReport(filePath); err == nil {
+		t.Errorf("expected an error for a text report")
+	}
+}
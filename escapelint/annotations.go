@@ -0,0 +1,1143 @@
+package escapelint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/token"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type AnnotationKind string
+
+const (
+	NoEscape      AnnotationKind = "no-escape"
+	NoEscapeFunc  AnnotationKind = "no-escape-func"
+	NoAlloc       AnnotationKind = "no-alloc"
+	NoEscapeBegin AnnotationKind = "no-escape-begin"
+	NoEscapeEnd   AnnotationKind = "no-escape-end"
+	NoHeapMove    AnnotationKind = "no-heap-move"
+	NoHeapEscape  AnnotationKind = "no-heap-escape"
+	StackAlloc    AnnotationKind = "stack-alloc"
+	NoBoundsCheck AnnotationKind = "no-bounds-check"
+	MaxAllocs     AnnotationKind = "max-allocs"
+	Expect        AnnotationKind = "expect"
+	MustInline    AnnotationKind = "must-inline"
+	AlwaysInlined AnnotationKind = "always-inlined"
+	NoInline      AnnotationKind = "no-inline"
+)
+
+// Annotation is a single annotation found in the source code, such as
+// "//no-escape: hot path, called per-request".
+type Annotation struct {
+	Kind   AnnotationKind
+	Symbol string   // what the annotation is about if there are several on the line, e.g. "buf" in "//no-escape:buf"
+	Arches []string // architectures the annotation is limited to, all if empty
+	Reason string   // optional free text following the colon
+
+	// Allow acknowledges that the annotation is not satisfied at the moment,
+	// as in "//no-escape:allow", so that it is reported as a warning rather
+	// than an error, and counted in the report.
+	Allow bool
+
+	// EndLine is the last line covered by a function-scoped annotation,
+	// which applies to the whole function body, or by a region started with
+	// no-escape-begin, which is the line of the matching no-escape-end,
+	// or by the statement of a no-escape annotation, see StartLine.
+	// It is zero otherwise.
+	EndLine int
+
+	// StartLine is the first line of the statement enclosing a no-escape
+	// annotation, if the statement spans several lines and the options ask
+	// to match the whole statement. It is zero otherwise.
+	StartLine int
+
+	// MaxAllocs is the number of heap allocations a function marked with
+	// max-allocs may perform, as in "//max-allocs=2". It is -1 if the budget
+	// is missing or malformed, which makes the annotation invalid.
+	MaxAllocs int
+
+	// Hint is the compiler hint required by an expect annotation, as in
+	// "//expect:stays-on-stack", for the cases the other annotations do not
+	// cover. It is empty for the other kinds.
+	Hint CompilerHint
+
+	// Func is the name of the function declared at the line of a must-inline
+	// or always-inlined annotation. The compiler reports inlining at the call
+	// sites, so the annotation is checked against the calls of the function
+	// anywhere.
+	Func string
+
+	// Column is the 1-based byte column of the comment holding the annotation,
+	// so that editors can point at it. The annotation is still checked against
+	// the whole line.
+	Column int
+
+	// prefix is the marker the annotation was written with, as set in the
+	// AnnotationOptions, e.g. "escape:" in "//escape:no-escape".
+	prefix string
+
+	// Sites are the declarations of the variables whose field address is
+	// taken, for an annotation placed on a struct field. The compiler reports
+	// the escape of the whole variable there rather than at the field.
+	Sites []Position
+}
+
+func (a Annotation) String() string {
+	s := string(a.Kind)
+
+	if a.Kind == MaxAllocs {
+		s += "=" + strconv.Itoa(a.MaxAllocs)
+	}
+
+	if a.Kind == Expect {
+		s += ":" + string(a.Hint)
+	}
+
+	if a.Symbol != "" {
+		s += ":" + a.Symbol
+	}
+
+	if len(a.Arches) > 0 {
+		s += ":" + strings.Join(a.Arches, ",")
+	}
+
+	if a.Allow {
+		s += ":" + allowQualifier
+	}
+
+	if a.Reason != "" {
+		s += fmt.Sprintf(" (%s)", a.Reason)
+	}
+
+	return s
+}
+
+// AppliesTo reports whether the annotation should be checked against the
+// compiler output produced for the given architecture.
+func (a Annotation) AppliesTo(goarch string) bool {
+	return len(a.Arches) == 0 || goarch == "" || slices.Contains(a.Arches, goarch)
+}
+
+// allowQualifier marks an annotation as acknowledged to fail.
+const allowQualifier = "allow"
+
+// knownArches lists the values of GOARCH that can qualify an annotation.
+var knownArches = []string{
+	"386", "amd64", "arm", "arm64", "loong64", "mips", "mipsle", "mips64", "mips64le",
+	"ppc64", "ppc64le", "riscv64", "s390x", "wasm",
+}
+
+// registryMu guards the annotations registered with RegisterChecker and
+// RegisterRule, along with the built-in ones they are added to.
+var registryMu sync.RWMutex
+
+var knownAnnotations = []AnnotationKind{
+	NoEscape,
+	NoEscapeFunc,
+	NoAlloc,
+	NoEscapeBegin,
+	NoEscapeEnd,
+	NoHeapMove,
+	NoHeapEscape,
+	StackAlloc,
+	NoBoundsCheck,
+	MaxAllocs,
+	Expect,
+	MustInline,
+	AlwaysInlined,
+	NoInline,
+}
+
+// fieldAnnotations can be placed on a struct field declaration.
+var fieldAnnotations = []AnnotationKind{
+	NoEscape,
+	NoHeapMove,
+	NoHeapEscape,
+}
+
+// funcScopedAnnotations are placed on the line of a function declaration or
+// a function literal, and cover the whole function body.
+var funcScopedAnnotations = []AnnotationKind{
+	NoEscapeFunc,
+	NoAlloc,
+	MaxAllocs,
+}
+
+const (
+	disableDirective     = "//escape-lint:disable"
+	enableDirective      = "//escape-lint:enable"
+	disableLineDirective = "//escape-lint:disable-line"
+)
+
+// AnnotationOptions control how the annotations are parsed.
+type AnnotationOptions struct {
+	// TypoDistance is the maximum edit distance between a comment and an
+	// annotation name for the comment to be reported as a probable typo.
+	// Zero disables the typo detection.
+	TypoDistance int
+
+	// TypoMaxLength is the maximum length of a comment checked for typos,
+	// since longer comments are unlikely to be misspelled annotations.
+	TypoMaxLength int
+
+	// Prefix is required at the start of every annotation, e.g. "escape:" to
+	// write them as "//escape:no-escape", so that they do not collide with the
+	// directives of other tools. Comments without it are not checked for typos.
+	Prefix string
+
+	// FollowSymlinks makes the walk descend into symbolic links to directories,
+	// which are skipped otherwise. Each directory is only walked once, so links
+	// pointing back up the tree do not loop.
+	FollowSymlinks bool
+
+	// SkipGenerated skips the files with the "// Code generated ... DO NOT EDIT."
+	// header, whose comments are not written by hand.
+	SkipGenerated bool
+
+	// RespectGitignore skips the files and directories ignored by git, such as
+	// build artifacts. Nothing is skipped outside of a git repository.
+	RespectGitignore bool
+
+	// IncludeTests parses the _test.go files too, e.g. to check the benchmarks
+	// against the output of go test -gcflags=-m -bench. They are skipped
+	// otherwise, since go build does not compile them.
+	IncludeTests bool
+
+	// Files limits the walk to the given files, e.g. the ones changed in a
+	// branch, if not nil. Relative paths are resolved against the working
+	// directory.
+	Files []string
+
+	// Tags enables the evaluation of the build constraints, so that the files
+	// excluded from the build with these tags are skipped, along with the ones
+	// for other platforms. The constraints are not evaluated if nil.
+	Tags []string
+
+	// GOARCH is the architecture the build constraints are evaluated for, the
+	// default of the go command is used if empty.
+	GOARCH string
+
+	// StatementSpan matches a no-escape annotation against the hints at all
+	// lines of the statement it is placed in, such as a call with its arguments
+	// wrapped, rather than only at its own line. It is enabled by default, since
+	// the compiler reports the escapes at the first line of the statement.
+	StatementSpan bool
+
+	// CacheDir is the directory where the annotations parsed from each file
+	// are cached, until the content of the file changes. Nothing is cached if
+	// empty.
+	CacheDir string
+
+	// RejectCodeless makes the annotations on lines without code invalid, which
+	// are only warned about otherwise, since they never match compiler output.
+	RejectCodeless bool
+
+	// OnTypo receives the comments that are probably misspelled annotations,
+	// which are then left to the caller, e.g. to report them as warnings. If it
+	// is nil, they are logged and make the annotations invalid instead.
+	OnTypo func(Typo)
+}
+
+// Typo is a comment that is probably a misspelled annotation.
+type Typo struct {
+	Position   Position
+	Comment    string
+	Suggestion string // the closest annotation, including the prefix, e.g. "//no-escape"
+	Distance   int    // edit distance between the comment and the suggestion
+}
+
+// Finding reports the typo as a warning suggesting the closest annotation.
+func (t Typo) Finding() Finding {
+	return Finding{
+		Position:   t.Position,
+		Severity:   SeverityWarning,
+		Subject:    "comment",
+		Message:    fmt.Sprintf("is probably a misspelled annotation, did you mean %s? (edit distance %d)", t.Suggestion, t.Distance),
+		Suggestion: t.Suggestion,
+		Distance:   t.Distance,
+	}
+}
+
+// DefaultAnnotationOptions returns the options used by the command line tool
+// unless overridden.
+func DefaultAnnotationOptions() AnnotationOptions {
+	return AnnotationOptions{
+		TypoDistance:  3,
+		TypoMaxLength: 20,
+		SkipGenerated: true,
+		StatementSpan: true,
+	}
+}
+
+// IsKnownAnnotation reports whether the kind is a built-in annotation or one
+// added with RegisterChecker or RegisterRule.
+func IsKnownAnnotation(kind AnnotationKind) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return slices.Contains(knownAnnotations, kind)
+}
+
+// validAnnotationName checks the name of a custom annotation. The characters
+// separating the name from a symbol, a budget or the next annotation would
+// make it impossible to match.
+func validAnnotationName(kind AnnotationKind) error {
+	if kind == "" || strings.ContainsAny(string(kind), ":= \t/") {
+		return fmt.Errorf("invalid annotation name: %q", kind)
+	}
+
+	return nil
+}
+
+// removeAnnotation removes a custom annotation from the known ones. The caller
+// holds the registry lock.
+func removeAnnotation(kind AnnotationKind) {
+	knownAnnotations = slices.DeleteFunc(knownAnnotations, func(known AnnotationKind) bool { return known == kind })
+}
+
+// closestAnnotation returns the known annotation with the smallest edit distance
+// to the text, if it is within the maximum distance. The first one in the list
+// of the known annotations wins a tie.
+func closestAnnotation(text string, maxDistance int) (AnnotationKind, int, bool) {
+	var closest AnnotationKind
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	best := maxDistance + 1
+	for _, ann := range knownAnnotations {
+		if distance := levenshteinDistance(text, string(ann)); distance < best {
+			closest, best = ann, distance
+		}
+	}
+
+	return closest, best, closest != ""
+}
+
+func levenshteinDistance(a, b string) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+
+	previous := make([]int, len(b)+1)
+	for i := range previous {
+		previous[i] = i
+	}
+
+	for i, ra := range a {
+		current := make([]int, len(b)+1)
+		current[0] = i + 1
+
+		for j, rb := range b {
+			insertions := previous[j+1] + 1
+			deletions := current[j] + 1
+			substitutions := previous[j]
+
+			if ra != rb {
+				substitutions++
+			}
+
+			current[j+1] = min(insertions, deletions, substitutions)
+		}
+
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// splitLine splits the line into the code and the comment following it, which
+// is normalized to the "//annotation" form.
+func splitLine(line string) (code, comment string) {
+	if i := commentStart(line); i != -1 {
+		return strings.TrimSpace(line[:i]), normalizeComment(strings.TrimSpace(line[i:]))
+	}
+
+	return strings.TrimSpace(line), ""
+}
+
+// commentStart returns the index of the first "//" or "/*" comment in the line,
+// or -1 if there is none.
+func commentStart(line string) int {
+	i := strings.Index(line, "//")
+	if j := strings.Index(line, "/*"); j != -1 && (i == -1 || j < i) {
+		return j
+	}
+
+	return i
+}
+
+// commentSpace matches the whitespace between a "//" and the comment text.
+var commentSpace = regexp.MustCompile(`(^|\s)//[ \t]+`)
+
+// normalizeComment rewrites a comment written as "/* no-escape */" or with a
+// space as in "// no-escape" to the "//no-escape" form, so that annotations are
+// recognized in any of them. Block comments spanning several lines are left as
+// they are.
+func normalizeComment(comment string) string {
+	if inner, ok := strings.CutPrefix(comment, "/*"); ok {
+		if end := strings.Index(inner, "*/"); end != -1 {
+			comment = strings.TrimSpace("//" + strings.TrimSpace(inner[:end]) + " " + strings.TrimSpace(inner[end+len("*/"):]))
+		}
+	}
+
+	return commentSpace.ReplaceAllString(comment, "$1//")
+}
+
+// isCodeLine reports whether the code part of a line may produce compiler hints,
+// unlike blank lines, lone brackets or import declarations.
+func isCodeLine(code string) bool {
+	if strings.Trim(code, "{}()[],;") == "" {
+		return false
+	}
+
+	return code != "import" && !strings.HasPrefix(code, "import ") && !strings.HasPrefix(code, "package ")
+}
+
+// containsDirective reports whether the comment contains the directive as a
+// whole word, so that "//escape-lint:disable" does not match "//escape-lint:disable-line".
+func containsDirective(comment, directive string) bool {
+	for i := 0; i < len(comment); {
+		j := strings.Index(comment[i:], directive)
+		if j == -1 {
+			return false
+		}
+
+		end := i + j + len(directive)
+		if end == len(comment) || comment[end] == ' ' || comment[end] == '\t' {
+			return true
+		}
+
+		i = end
+	}
+
+	return false
+}
+
+// commentSeparator matches the start of every "//" comment within a comment
+// string, except for the ones that are part of a URL.
+var commentSeparator = regexp.MustCompile(`(?:^|\s)//`)
+
+// parseAnnotations extracts all annotations from the comment part of a line.
+// Each annotation is a separate "//" comment starting with the annotation kind,
+// optionally followed by a symbol name, architecture qualifiers and a reason,
+// each preceded by a colon: "//no-bounds-check:amd64,arm64: hot path". A single
+// identifier ending the comment or followed by another colon is a symbol name,
+// as in "//no-escape:buf: hot path". If the prefix is not empty, only the
+// comments starting with it are annotations.
+func parseAnnotations(comment, prefix string) []Annotation {
+	var annotations []Annotation
+
+	for _, segment := range commentSeparator.Split(comment, -1) {
+		segment, ok := strings.CutPrefix(segment, prefix)
+		if !ok {
+			continue
+		}
+
+		keyword, rest := segment, ""
+		if i := strings.IndexAny(segment, ": \t"); i != -1 {
+			keyword, rest = segment[:i], segment[i:]
+		}
+
+		// The allocation budget is the only value given with "=".
+		keyword, budget, hasBudget := strings.Cut(keyword, "=")
+
+		kind := AnnotationKind(keyword)
+		if !IsKnownAnnotation(kind) || hasBudget && kind != MaxAllocs {
+			continue
+		}
+
+		ann := Annotation{Kind: kind, prefix: prefix}
+
+		if kind == MaxAllocs {
+			ann.MaxAllocs = parseBudget(budget)
+		}
+
+		// The hint names are not identifiers, so the one expected is taken
+		// before the other qualifiers.
+		if after, ok := strings.CutPrefix(rest, ":"); ok && kind == Expect {
+			hint := after
+			if i := strings.IndexAny(after, ": \t"); i != -1 {
+				hint = after[:i]
+			}
+
+			ann.Hint, rest = CompilerHint(hint), after[len(hint):]
+		}
+
+		for {
+			after, ok := strings.CutPrefix(rest, ":")
+			if !ok {
+				break
+			}
+
+			qualifier := after
+			if i := strings.IndexAny(after, ": \t"); i != -1 {
+				qualifier = after[:i]
+			}
+
+			rest = after[len(qualifier):]
+
+			// Anything that is not a list of known architectures, the allow
+			// marker or a symbol name is a reason.
+			arches := strings.Split(qualifier, ",")
+			switch {
+			case isKnownArchList(arches):
+				ann.Arches = append(ann.Arches, arches...)
+			case qualifier == allowQualifier && (rest == "" || rest[0] == ':'):
+				ann.Allow = true
+			case ann.Symbol == "" && token.IsIdentifier(qualifier) && (rest == "" || rest[0] == ':'):
+				ann.Symbol = qualifier
+			default:
+				ann.Reason = strings.TrimSpace(after)
+			}
+
+			if ann.Reason != "" {
+				break
+			}
+		}
+
+		annotations = append(annotations, ann)
+	}
+
+	return annotations
+}
+
+// unknownArches returns the unknown entries of a misspelled list of architectures,
+// as in "//no-bounds-check:amd64,amr64", which is parsed as a reason otherwise.
+// A single word cannot be told apart from a reason, so only the lists with at
+// least one known architecture are checked.
+func unknownArches(ann Annotation) []string {
+	qualifier := ann.Reason
+	if i := strings.IndexAny(qualifier, ": \t"); i != -1 {
+		qualifier = qualifier[:i]
+	}
+
+	arches := strings.Split(qualifier, ",")
+	if len(arches) < 2 || !slices.ContainsFunc(arches, isKnownArch) {
+		return nil
+	}
+
+	return slices.DeleteFunc(arches, isKnownArch)
+}
+
+func isKnownArch(arch string) bool {
+	return slices.Contains(knownArches, arch)
+}
+
+// parseBudget parses the number of allocations of a max-allocs annotation,
+// returning -1 if it is not a non-negative number.
+func parseBudget(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return -1
+	}
+
+	return n
+}
+
+func isKnownArchList(arches []string) bool {
+	for _, arch := range arches {
+		if !slices.Contains(knownArches, arch) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// buildContext returns the context evaluating the build constraints of the
+// files for the tags and the architecture of the options.
+func buildContext(opts AnnotationOptions) *build.Context {
+	ctxt := build.Default
+	ctxt.BuildTags = opts.Tags
+
+	if opts.GOARCH != "" {
+		ctxt.GOARCH = opts.GOARCH
+	}
+
+	return &ctxt
+}
+
+func ParseCodeAnnotations(packagePath string, opts AnnotationOptions) (map[Position][]Annotation, bool, error) {
+	annotations := make(map[Position][]Annotation)
+	valid := true
+
+	err := WalkGoFiles(packagePath, opts, func(path string) error {
+		fileAnnotations, fileValid, err := parseCachedFile(path, opts)
+		if err != nil {
+			return err
+		}
+
+		if !fileValid {
+			valid = false
+		}
+
+		maps.Copy(annotations, fileAnnotations)
+
+		return nil
+	})
+	if err != nil {
+		return nil, valid, err
+	}
+
+	if err := resolveFieldSites(annotations, buildContext(opts), opts); err != nil {
+		return nil, valid, err
+	}
+
+	return annotations, valid, nil
+}
+
+// WalkGoFiles calls fn for every Go file of the package that ParseCodeAnnotations
+// parses with the options, so that a tool watching the files for changes looks
+// at the same ones. The directories are skipped and the symbolic links followed
+// like in a run, and the walk stops at the first error returned by fn.
+func WalkGoFiles(packagePath string, opts AnnotationOptions, fn func(path string) error) error {
+	// The real paths of the directories walked so far, to walk each of them
+	// only once when symbolic links are followed, even if they form a loop.
+	visited := make(map[string]bool)
+
+	ctxt := buildContext(opts)
+
+	var only map[string]bool
+	if opts.Files != nil {
+		only = make(map[string]bool, len(opts.Files))
+		for _, file := range opts.Files {
+			only[normalizePath(file)] = true
+		}
+	}
+
+	var ignored map[string]bool
+	if opts.RespectGitignore {
+		if info, err := os.Stat(packagePath); err == nil && info.IsDir() {
+			ignored = gitIgnored(packagePath)
+		}
+	}
+
+	// The package path is either a directory, which is walked recursively, or
+	// a single file, which is checked even if it would be skipped in a walk.
+	var walkFn filepath.WalkFunc
+
+	walkFn = func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		isRoot := currentPath == packagePath
+
+		// Skip hidden directories and vendor
+		if info.IsDir() && !isRoot && isSkippedDir(info.Name()) {
+			return filepath.SkipDir
+		}
+
+		if !isRoot && ignored[normalizePath(currentPath)] {
+			debugf("skipping %s ignored by git", currentPath)
+
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.IsDir() && opts.FollowSymlinks {
+			realPath, err := filepath.EvalSymlinks(currentPath)
+			if err != nil {
+				return err
+			}
+
+			if visited[realPath] {
+				return filepath.SkipDir
+			}
+
+			visited[realPath] = true
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		// A link to a directory is walked through a trailing separator, which
+		// makes the walk resolve it.
+		if info.Mode()&os.ModeSymlink != 0 && isDir(currentPath) {
+			if !opts.FollowSymlinks || isSkippedDir(info.Name()) {
+				debugf("skipping symbolic link to a directory %s", currentPath)
+				return nil
+			}
+
+			return filepath.Walk(currentPath+string(filepath.Separator), walkFn)
+		}
+
+		if !strings.HasSuffix(currentPath, ".go") {
+			if isRoot {
+				return fmt.Errorf("not a Go file: %s", currentPath)
+			}
+
+			return nil
+		}
+
+		if only != nil && !only[normalizePath(currentPath)] {
+			return nil
+		}
+
+		if !isRoot {
+			if included, err := includesFile(ctxt, currentPath, opts); err != nil || !included {
+				return err
+			}
+		}
+
+		return fn(currentPath)
+	}
+
+	return filepath.Walk(packagePath, walkFn)
+}
+
+// includesFile tells whether the Go file is compiled along with the package:
+// the tests only are with IncludeTests, and with Tags, the files excluded by
+// their build constraints are not.
+func includesFile(ctxt *build.Context, path string, opts AnnotationOptions) (bool, error) {
+	if !opts.IncludeTests && strings.HasSuffix(path, "_test.go") {
+		return false, nil
+	}
+
+	if opts.Tags == nil {
+		return true, nil
+	}
+
+	match, err := ctxt.MatchFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return false, err
+	}
+
+	if !match {
+		debugf("skipping %s excluded by the build constraints", path)
+	}
+
+	return match, nil
+}
+
+// isDir tells whether the path, resolving symbolic links, is a directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// isSkippedDir tells whether the walk skips a directory with the given name.
+func isSkippedDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "vendor"
+}
+
+// parseFileAnnotations parses the annotations in the source of a single Go file.
+// The filename is only used in the positions and the messages. The source is
+// read at once, since the functions covered by the annotations are found in its
+// syntax tree.
+func parseFileAnnotations(r io.Reader, filename string, opts AnnotationOptions) (map[Position][]Annotation, bool, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	annotations, valid, _, err := parseSource(src, filename, opts)
+
+	return annotations, valid, err
+}
+
+// parseSource parses the annotations in the source of a file. Besides whether
+// they are valid, it reports whether any warnings were logged, since the files
+// with any problems are not cached and parsed again every time.
+func parseSource(src []byte, filename string, opts AnnotationOptions) (annotations map[Position][]Annotation, valid, warned bool, err error) {
+	annotations = make(map[Position][]Annotation)
+	valid = true
+
+	if opts.SkipGenerated && isGenerated(filename, src) {
+		debugf("skipping generated file %s", filename)
+		return annotations, valid, warned, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(nil, MaxLineLength)
+	disabledDepth := 0
+	lineNum := 0
+
+	var funcScoped []Position
+
+	// The must-inline annotations that are not named, which may be placed
+	// on a function declaration rather than a call.
+	var mustInline []Position
+
+	// The no-escape annotations, which may be placed on any line of a
+	// statement spanning several lines.
+	var noEscape []Position
+
+	// The region started by the last no-escape-begin marker, if it is
+	// not terminated yet. Regions cannot be nested.
+	var region *Position
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := scanner.Text()
+		code, comment := splitLine(line)
+
+		// An unclosed disable directive extends to the end of the file,
+		// while an unmatched enable directive is ignored.
+		switch {
+		case containsDirective(comment, disableLineDirective):
+			continue
+		case containsDirective(comment, disableDirective):
+			disabledDepth++
+			continue
+		case containsDirective(comment, enableDirective):
+			disabledDepth = max(disabledDepth-1, 0)
+			continue
+		}
+
+		if disabledDepth > 0 || comment == "" {
+			continue
+		}
+
+		lineAnnotations := parseAnnotations(comment, opts.Prefix)
+
+		column := commentStart(line) + 1
+		for i := range lineAnnotations {
+			lineAnnotations[i].Column = column
+			debugf("found %s at %s:%d:%d", lineAnnotations[i], filename, lineNum, column)
+		}
+
+		// Region markers usually sit on lines of their own, so they are
+		// handled before the lines without code are skipped.
+		for _, ann := range lineAnnotations {
+			pos := Position{File: normalizePath(filename), Line: lineNum}
+
+			switch {
+			case ann.Kind == NoEscapeBegin && region != nil:
+				log.Printf("%s at %s:%d is inside another region started at line %d", NoEscapeBegin, filename, lineNum, region.Line)
+				valid = false
+			case ann.Kind == NoEscapeBegin:
+				region = &pos
+				annotations[pos] = append(annotations[pos], ann)
+			case ann.Kind == NoEscapeEnd && region == nil:
+				log.Printf("%s at %s:%d has no matching %s", NoEscapeEnd, filename, lineNum, NoEscapeBegin)
+				valid = false
+			case ann.Kind == NoEscapeEnd:
+				for i, begin := range annotations[*region] {
+					if begin.Kind == NoEscapeBegin {
+						annotations[*region][i].EndLine = lineNum
+					}
+				}
+
+				region = nil
+			}
+		}
+
+		// A region marker is not a typo either, even if it is the only
+		// annotation on a line of code.
+		found := len(lineAnnotations) > 0
+		lineAnnotations = slices.DeleteFunc(lineAnnotations, isRegionMarker)
+
+		// The compiler never reports anything for such lines, so the
+		// annotation is likely left behind after the code was removed.
+		if !isCodeLine(code) {
+			switch {
+			case len(lineAnnotations) > 0 && opts.RejectCodeless:
+				log.Printf("annotation on a line without code at %s:%d", filename, lineNum)
+				valid = false
+			case len(lineAnnotations) > 0:
+				log.Printf("warning: annotation on a line without code at %s:%d", filename, lineNum)
+				warned = true
+			}
+
+			continue
+		}
+
+		if len(lineAnnotations) > 0 {
+			normalizedFile := normalizePath(filename)
+			lineKey := Position{File: normalizedFile, Line: lineNum}
+			annotations[lineKey] = append(annotations[lineKey], lineAnnotations...)
+
+			if slices.ContainsFunc(lineAnnotations, isFuncScoped) {
+				funcScoped = append(funcScoped, lineKey)
+			}
+
+			if slices.ContainsFunc(lineAnnotations, isUnnamedInlining) {
+				mustInline = append(mustInline, lineKey)
+			}
+
+			if slices.ContainsFunc(lineAnnotations, isNoEscape) {
+				noEscape = append(noEscape, lineKey)
+			}
+		}
+
+		// We haven't found any annotations, but there is some suspicious comment.
+		// Let’s check if this might be an annotation with a typo.
+		// With a prefix, only the comments starting with it are checked.
+		candidate, hasPrefix := strings.CutPrefix(comment, "//"+opts.Prefix)
+		if !found && hasPrefix && opts.TypoDistance > 0 && len(candidate)+len("//") <= opts.TypoMaxLength {
+			if ann, distance, ok := closestAnnotation("//"+candidate, opts.TypoDistance); ok {
+				typo := Typo{
+					Position:   Position{File: normalizePath(filename), Line: lineNum},
+					Comment:    comment,
+					Suggestion: "//" + opts.Prefix + string(ann),
+					Distance:   distance,
+				}
+
+				// The file is not cached either way, so that the typo is
+				// reported again on the next run.
+				if opts.OnTypo != nil {
+					opts.OnTypo(typo)
+					warned = true
+				} else {
+					log.Printf("probably a typo '%s' at %s:%d (did you mean %s?)", comment, filename, lineNum, typo.Suggestion)
+					valid = false
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, valid, warned, err
+	}
+
+	if region != nil {
+		log.Printf("%s at %s:%d is not terminated with %s", NoEscapeBegin, filename, region.Line, NoEscapeEnd)
+		valid = false
+
+		annotations[*region] = slices.DeleteFunc(annotations[*region], isRegionMarker)
+		if len(annotations[*region]) == 0 {
+			delete(annotations, *region)
+		}
+	}
+
+	if len(funcScoped) > 0 && !resolveFuncScopes(filename, src, funcScoped, annotations) {
+		valid = false
+	}
+
+	if len(mustInline) > 0 {
+		resolveInlinedFuncs(filename, src, mustInline, annotations)
+	}
+
+	if len(noEscape) > 0 && opts.StatementSpan {
+		resolveStatementSpans(filename, src, noEscape, annotations)
+	}
+
+	return annotations, valid, warned, nil
+}
+
+func isFuncScoped(ann Annotation) bool {
+	return slices.Contains(funcScopedAnnotations, ann.Kind)
+}
+
+func isRegionMarker(ann Annotation) bool {
+	return ann.Kind == NoEscapeBegin || ann.Kind == NoEscapeEnd
+}
+
+// resolveFuncScopes sets the end line of the function-scoped annotations found at
+// the given positions of the file. It reports false if some of them are not placed
+// on the first line of a function.
+func resolveFuncScopes(filePath string, src []byte, positions []Position, annotations map[Position][]Annotation) bool {
+	ranges, err := funcLineRanges(filePath, src)
+	if err != nil {
+		debugf("failed to parse %s: %s", filePath, err)
+	}
+
+	valid := true
+
+	for _, pos := range positions {
+		endLine, ok := ranges[pos.Line]
+		if !ok {
+			log.Printf("function annotation is not on a function at %s:%d", filePath, pos.Line)
+			valid = false
+
+			continue
+		}
+
+		for i, ann := range annotations[pos] {
+			if isFuncScoped(ann) {
+				annotations[pos][i].EndLine = endLine
+			}
+		}
+	}
+
+	return valid
+}
+
+// isInlining reports whether the annotation requires the function to be inlined.
+func isInlining(ann Annotation) bool {
+	return ann.Kind == MustInline || ann.Kind == AlwaysInlined
+}
+
+func isUnnamedInlining(ann Annotation) bool {
+	return isInlining(ann) && ann.Symbol == ""
+}
+
+// resolveInlinedFuncs sets the function name of the inlining annotations placed
+// on function declarations. The ones on other lines are about the calls
+// at the line and are left as they are.
+func resolveInlinedFuncs(filePath string, src []byte, positions []Position, annotations map[Position][]Annotation) {
+	names, err := funcDeclNames(filePath, src)
+	if err != nil {
+		debugf("failed to parse %s: %s", filePath, err)
+	}
+
+	for _, pos := range positions {
+		name, ok := names[pos.Line]
+		if !ok {
+			continue
+		}
+
+		for i, ann := range annotations[pos] {
+			if isUnnamedInlining(ann) {
+				annotations[pos][i].Func = name
+			}
+		}
+	}
+}
+
+func isNoEscape(ann Annotation) bool {
+	return ann.Kind == NoEscape
+}
+
+// resolveStatementSpans sets the lines of the enclosing statement of the
+// no-escape annotations that are placed in a statement spanning several lines.
+func resolveStatementSpans(filePath string, src []byte, positions []Position, annotations map[Position][]Annotation) {
+	spans, err := statementSpans(filePath, src)
+	if err != nil {
+		debugf("failed to parse %s: %s", filePath, err)
+	}
+
+	for _, pos := range positions {
+		span, ok := spans[pos.Line]
+		if !ok {
+			continue
+		}
+
+		for i, ann := range annotations[pos] {
+			if isNoEscape(ann) {
+				annotations[pos][i].StartLine = span.Start
+				annotations[pos][i].EndLine = span.End
+			}
+		}
+	}
+}
+
+// resolveFieldSites finds the sites of the annotations placed on struct fields.
+// Each package with such annotations is parsed as a whole, since the fields are
+// often used outside of the file declaring the struct. The files are the ones
+// the walk would include, regardless of the ones changed, since the sites are
+// anywhere in the package.
+func resolveFieldSites(annotations map[Position][]Annotation, ctxt *build.Context, opts AnnotationOptions) error {
+	byDir := make(map[string][]Position)
+
+	for pos, anns := range annotations {
+		if slices.ContainsFunc(anns, func(ann Annotation) bool { return slices.Contains(fieldAnnotations, ann.Kind) }) {
+			dir := filepath.Dir(pos.File)
+			byDir[dir] = append(byDir[dir], pos)
+		}
+	}
+
+	for dir, positions := range byDir {
+		fset, files, err := parsePackageFiles(dir, func(path string) (bool, error) {
+			return includesFile(ctxt, path, opts)
+		})
+		if err != nil {
+			return err
+		}
+
+		fieldLines := make(map[string]map[int][]fieldRef)
+		for _, file := range files {
+			fieldLines[normalizePath(fset.Position(file.Pos()).Filename)] = structFieldLines(fset, file)
+		}
+
+		var sites map[fieldRef][]Position
+
+		for _, pos := range positions {
+			refs := fieldLines[pos.File][pos.Line]
+			if len(refs) == 0 {
+				continue
+			}
+
+			if sites == nil {
+				sites = fieldAddressSites(fset, files)
+			}
+
+			for i, ann := range annotations[pos] {
+				if !slices.Contains(fieldAnnotations, ann.Kind) {
+					continue
+				}
+
+				for _, ref := range refs {
+					annotations[pos][i].Sites = append(annotations[pos][i].Sites, sites[ref]...)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// conflictingAnnotations lists pairs of annotations that can never be satisfied
+// at the same time, so having both at one position is certainly a mistake.
+var conflictingAnnotations = [][2]AnnotationKind{
+	{MustInline, NoInline},
+	{AlwaysInlined, NoInline},
+}
+
+// ValidateAnnotations checks that no position has mutually exclusive annotations.
+func ValidateAnnotations(codeAnnotations map[Position][]Annotation) (valid bool) {
+	valid = true
+
+	for pos, annotations := range codeAnnotations {
+		kinds := make([]AnnotationKind, 0, len(annotations))
+		for _, ann := range annotations {
+			kinds = append(kinds, ann.Kind)
+		}
+
+		for _, pair := range conflictingAnnotations {
+			if slices.Contains(kinds, pair[0]) && slices.Contains(kinds, pair[1]) {
+				log.Printf("conflicting annotations %s and %s at %s:%d", pair[0], pair[1], pos.File, pos.Line)
+				valid = false
+			}
+		}
+
+		for _, ann := range annotations {
+			if ann.Kind == Expect && ann.Hint == "" {
+				log.Printf("%s at %s:%d needs a compiler hint, as in %s:%s", ann.Kind, pos.File, pos.Line, ann.Kind, StaysOnStack)
+				valid = false
+			} else if ann.Kind == Expect && !slices.Contains(knownHints, ann.Hint) {
+				log.Printf("unknown compiler hint %q in %s at %s:%d, expected one of: %s", ann.Hint, ann.Kind, pos.File, pos.Line, hintNames())
+				valid = false
+			}
+
+			if ann.Kind == MaxAllocs && ann.MaxAllocs < 0 {
+				log.Printf("%s at %s:%d needs a number of allocations, as in %s=2", ann.Kind, pos.File, pos.Line, ann.Kind)
+				valid = false
+			}
+
+			// The compiler does not say which access is bounds-checked, so the
+			// name could not narrow the hints down, and is likely a misspelled
+			// architecture.
+			if ann.Kind == NoBoundsCheck && ann.Symbol != "" {
+				log.Printf("%s at %s:%d cannot name %s, since bounds checks are reported without the accessed value; is it an architecture?",
+					ann.Kind, pos.File, pos.Line, ann.Symbol)
+				valid = false
+			}
+
+			if unknown := unknownArches(ann); len(unknown) > 0 {
+				log.Printf("unknown architecture %s in %s at %s:%d", strings.Join(unknown, ","), ann.Kind, pos.File, pos.Line)
+				valid = false
+			}
+		}
+	}
+
+	return valid
+}
@@ -0,0 +1,1098 @@
+package escapelint
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCodeAnnotations(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	var a int //no-escape
+	var b int //no-bounds-check
+	var c int //must-inline
+	var d int //no-inline
+}
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	results, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	expected := map[Position][]Annotation{
+		{File: mainGoFile, Line: 5}: {{Kind: NoEscape, Column: 12}},
+		{File: mainGoFile, Line: 6}: {{Kind: NoBoundsCheck, Column: 12}},
+		{File: mainGoFile, Line: 7}: {{Kind: MustInline, Column: 12}},
+		{File: mainGoFile, Line: 8}: {{Kind: NoInline, Column: 12}},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	if !valid {
+		t.Errorf("expected annotations to be valid")
+	}
+}
+
+func TestParseCodeAnnotationsSingleFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"hot.go":      "package main\n\nvar a = new(int) //no-escape\n",
+		"other.go":    "package main\n\nvar b = new(int) //no-escape\n",
+		"hot_test.go": "package main\n\nvar c = new(int) //no-escape\n",
+		"notes.txt":   "var d = new(int) //no-escape\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"hot.go", "hot_test.go"} {
+		t.Run(name, func(t *testing.T) {
+			filePath := filepath.Join(tmpDir, name)
+
+			results, _, err := ParseCodeAnnotations(filePath, DefaultAnnotationOptions())
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			expected := map[Position][]Annotation{
+				{File: filePath, Line: 3}: {{Kind: NoEscape, Column: 18}},
+			}
+
+			if !reflect.DeepEqual(results, expected) {
+				t.Errorf("expected %v, got %v", expected, results)
+			}
+		})
+	}
+
+	if _, _, err := ParseCodeAnnotations(filepath.Join(tmpDir, "notes.txt"), DefaultAnnotationOptions()); err == nil {
+		t.Errorf("expected an error for a non-Go file")
+	}
+}
+
+func TestParseCodeAnnotationsSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	pkgDir := filepath.Join(tmpDir, "pkg")
+	sharedDir := filepath.Join(tmpDir, "shared")
+
+	for _, dir := range []string{pkgDir, sharedDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(pkgDir, "main.go"):   "package main\n\nvar a = new(int) //no-escape\n",
+		filepath.Join(sharedDir, "lib.go"): "package main\n\nvar b = new(int) //no-escape\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	// The second link points back to the package itself and would loop forever
+	// if the walk did not keep track of the directories already visited.
+	if err := os.Symlink(sharedDir, filepath.Join(pkgDir, "lib")); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+
+	if err := os.Symlink(pkgDir, filepath.Join(pkgDir, "loop")); err != nil {
+		t.Fatalf("failed to create symbolic link: %v", err)
+	}
+
+	tests := map[string]struct {
+		followSymlinks bool
+		expected       map[Position][]Annotation
+	}{
+		"skipped by default": {
+			followSymlinks: false,
+			expected: map[Position][]Annotation{
+				{File: filepath.Join(pkgDir, "main.go"), Line: 3}: {{Kind: NoEscape, Column: 18}},
+			},
+		},
+		"followed": {
+			followSymlinks: true,
+			expected: map[Position][]Annotation{
+				{File: filepath.Join(pkgDir, "main.go"), Line: 3}:       {{Kind: NoEscape, Column: 18}},
+				{File: filepath.Join(pkgDir, "lib", "lib.go"), Line: 3}: {{Kind: NoEscape, Column: 18}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.FollowSymlinks = tt.followSymlinks
+
+			results, _, err := ParseCodeAnnotations(pkgDir, opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(results, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, results)
+			}
+		})
+	}
+}
+
+func TestParseCodeAnnotationsGitignore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		".gitignore":      "build/\n*.gen.go\n",
+		"main.go":         "package main\n\nvar a = new(int) //no-escape\n",
+		"types.gen.go":    "package main\n\nvar b = new(int) //no-escape\n",
+		"build/output.go": "package main\n\nvar c = new(int) //no-escape\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	all := map[Position][]Annotation{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 3}:            {{Kind: NoEscape, Column: 18}},
+		{File: filepath.Join(tmpDir, "types.gen.go"), Line: 3}:       {{Kind: NoEscape, Column: 18}},
+		{File: filepath.Join(tmpDir, "build", "output.go"), Line: 3}: {{Kind: NoEscape, Column: 18}},
+	}
+
+	opts := DefaultAnnotationOptions()
+	opts.RespectGitignore = true
+
+	// Outside of a git repository, nothing is skipped.
+	results, _, err := ParseCodeAnnotations(tmpDir, opts)
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(results, all) {
+		t.Errorf("expected %v outside of a repository, got %v", all, results)
+	}
+
+	if output, err := exec.Command("git", "init", "-q", tmpDir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, output)
+	}
+
+	results, _, err = ParseCodeAnnotations(tmpDir, opts)
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	expected := map[Position][]Annotation{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 3}: {{Kind: NoEscape, Column: 18}},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	// The ignored files are only skipped with the option.
+	results, _, err = ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(results, all) {
+		t.Errorf("expected %v without the option, got %v", all, results)
+	}
+}
+
+func TestParseCodeAnnotationsGenerated(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"main.go":          "package main\n\nvar a = new(int) //no-escape\n",
+		"kind_string.go":   "// Code generated by \"stringer -type=Kind\"; DO NOT EDIT.\n\npackage main\n\nvar b = new(int) //no-escape\nvar c = 1 //no-escap\n",
+		"licensed.gen.go":  "// Copyright 2024 The Authors.\n\n// Code generated by gen. DO NOT EDIT.\n\npackage main\n\nvar d = new(int) //no-escape\n",
+		"not_generated.go": "package main\n\n// Code generated by gen. DO NOT EDIT.\nvar e = new(int) //no-escape\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := map[string]struct {
+		skipGenerated bool
+		expected      []string
+		valid         bool
+	}{
+		// The typo in the generated file is not reported either.
+		"skipped": {skipGenerated: true, expected: []string{"main.go", "not_generated.go"}, valid: true},
+		"included": {
+			skipGenerated: false,
+			expected:      []string{"kind_string.go", "licensed.gen.go", "main.go", "not_generated.go"},
+			valid:         false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.SkipGenerated = tt.skipGenerated
+
+			results, valid, err := ParseCodeAnnotations(tmpDir, opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			var files []string
+			for pos := range results {
+				files = append(files, filepath.Base(pos.File))
+			}
+
+			slices.Sort(files)
+
+			if !slices.Equal(files, tt.expected) {
+				t.Errorf("expected annotations in %v, got %v", tt.expected, files)
+			}
+
+			if valid != tt.valid {
+				t.Errorf("expected valid=%v, got %v", tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestParseCodeAnnotationsTags(t *testing.T) {
+	tests := map[string]struct {
+		tags     []string
+		expected []string
+	}{
+		"not evaluated":  {tags: nil, expected: []string{"main.go", "sum_fast.go", "sum_purego.go"}},
+		"without tags":   {tags: []string{}, expected: []string{"main.go", "sum_fast.go"}},
+		"with purego":    {tags: []string{"purego"}, expected: []string{"main.go", "sum_purego.go"}},
+		"unrelated tags": {tags: []string{"debug"}, expected: []string{"main.go", "sum_fast.go"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.Tags = tt.tags
+
+			results, _, err := ParseCodeAnnotations("testdata/tags", opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			var files []string
+			for pos := range results {
+				if file := filepath.Base(pos.File); !slices.Contains(files, file) {
+					files = append(files, file)
+				}
+			}
+
+			slices.Sort(files)
+
+			if !slices.Equal(files, tt.expected) {
+				t.Errorf("expected annotations in %v, got %v", tt.expected, files)
+			}
+		})
+	}
+}
+
+func TestParseCodeAnnotationsLongLines(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := "package main\n\nvar table = []byte(\"" + strings.Repeat("x", 100*1024) + "\")\nvar a = new(int) //no-escape\n"
+
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	results, _, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	expected := map[Position][]Annotation{
+		{File: mainGoFile, Line: 4}: {{Kind: NoEscape, Column: 18}},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCodeAnnotationsDisableDirectives(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	var a int //no-escape
+	//escape-lint:disable
+	var b int //no-escape
+	//escape-lint:disable
+	var c int //no-escape
+	//escape-lint:enable
+	var d int //no-escape
+	//escape-lint:enable
+	var e int //no-escape //escape-lint:disable-line
+	var f int //no-escape
+	//escape-lint:disable
+	var g int //no-escape
+}
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	results, _, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	expected := map[Position][]Annotation{
+		{File: mainGoFile, Line: 5}:  {{Kind: NoEscape, Column: 12}},
+		{File: mainGoFile, Line: 14}: {{Kind: NoEscape, Column: 12}},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCodeAnnotationsReason(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	var a int //no-escape: hot path, called per-request
+	foo()     //must-inline // a regular comment
+	var b int //no-escape //must-inline: see https://go.dev/wiki/CompilerOptimizations
+}
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	results, _, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	expected := map[Position][]Annotation{
+		{File: mainGoFile, Line: 5}: {{Kind: NoEscape, Reason: "hot path, called per-request", Column: 12}},
+		{File: mainGoFile, Line: 6}: {{Kind: MustInline, Column: 12}},
+		{File: mainGoFile, Line: 7}: {
+			{Kind: NoEscape, Column: 12},
+			{Kind: MustInline, Reason: "see https://go.dev/wiki/CompilerOptimizations", Column: 12},
+		},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCodeAnnotationsFuncScope(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func hot(n int) int { //no-escape-func
+	buf := make([]byte, n)
+	handler := func() { //no-escape-func
+		_ = buf
+	}
+	handler()
+	return len(buf)
+}
+
+var x = new(int) //no-escape-func
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	results, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	expected := map[Position][]Annotation{
+		{File: mainGoFile, Line: 4}:  {{Kind: NoEscapeFunc, EndLine: 11, Column: 23}},
+		{File: mainGoFile, Line: 6}:  {{Kind: NoEscapeFunc, EndLine: 8, Column: 22}},
+		{File: mainGoFile, Line: 13}: {{Kind: NoEscapeFunc, Column: 18}},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	if valid {
+		t.Errorf("expected annotation outside of a function to be invalid")
+	}
+}
+
+func TestParseCodeAnnotationsRegions(t *testing.T) {
+	results, valid, err := ParseCodeAnnotations("testdata/region", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	mainGo := absPath(t, "testdata", "region", "main.go")
+
+	expected := map[Position][]Annotation{
+		{File: mainGo, Line: 11}: {{Kind: NoEscapeBegin, Reason: "hot loop", EndLine: 18, Column: 2}},
+	}
+
+	if !reflect.DeepEqual(results, expected) || !valid {
+		t.Errorf("expected %v, got %v (valid: %t)", expected, results, valid)
+	}
+
+	for name, mainGo := range map[string]string{
+		"unterminated": "package main\n\nfunc main() {\n\t//no-escape-begin\n\t_ = 1\n}\n",
+		"unmatched":    "package main\n\nfunc main() {\n\t_ = 1\n\t//no-escape-end\n}\n",
+		"nested":       "package main\n\nfunc main() {\n\t//no-escape-begin\n\t//no-escape-begin\n\t_ = 1\n\t//no-escape-end\n}\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(mainGo), 0644); err != nil {
+				t.Fatalf("failed to write to main.go: %v", err)
+			}
+
+			if _, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions()); err != nil || valid {
+				t.Errorf("expected the annotations to be invalid, got valid: %t, err: %v", valid, err)
+			}
+		})
+	}
+
+	// The markers may also be placed on the lines of code, which are not
+	// mistaken for typos.
+	t.Run("codeLines", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		mainGo := "package main\n\nfunc main() {\n\tx := 1 //no-escape-begin\n\t_ = x //no-escape-end\n}\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(mainGo), 0644); err != nil {
+			t.Fatalf("failed to write to main.go: %v", err)
+		}
+
+		if _, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions()); err != nil || !valid {
+			t.Errorf("expected the annotations to be valid, got valid: %t, err: %v", valid, err)
+		}
+	})
+}
+
+func TestParseCodeAnnotationsNonCodeLines(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main //no-escape
+
+import "fmt" //must-inline
+
+func main() {
+	//no-escape
+	var a int //no-escape
+	if a > 0 {
+		fmt.Println(a)
+	} //must-inline
+} //no-escape
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	var logs bytes.Buffer
+
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	results, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	if !valid {
+		t.Errorf("expected the annotations on lines without code to only be warned about")
+	}
+
+	expected := map[Position][]Annotation{
+		{File: mainGoFile, Line: 8}: {{Kind: NoEscape, Column: 12}},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	for _, line := range []int{2, 4, 7, 11, 12} {
+		expectedLog := fmt.Sprintf("annotation on a line without code at %s:%d", mainGoFile, line)
+		if !strings.Contains(logs.String(), expectedLog) {
+			t.Errorf("expected warning %q, got %q", expectedLog, logs.String())
+		}
+	}
+
+	opts := DefaultAnnotationOptions()
+	opts.RejectCodeless = true
+
+	if _, valid, _ := ParseCodeAnnotations(tmpDir, opts); valid {
+		t.Errorf("expected the annotations on lines without code to be invalid with RejectCodeless")
+	}
+}
+
+func TestParseCodeAnnotationsTypos(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	var a int //no-escpae
+	var b int //noescape-func
+}
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		opts          AnnotationOptions
+		expectedValid bool
+	}{
+		{name: "default", opts: DefaultAnnotationOptions(), expectedValid: false},
+		{name: "disabled", opts: AnnotationOptions{TypoDistance: 0, TypoMaxLength: 20}, expectedValid: true},
+		{name: "strictDistance", opts: AnnotationOptions{TypoDistance: 1, TypoMaxLength: 20}, expectedValid: true},
+		{name: "shortComments", opts: AnnotationOptions{TypoDistance: 3, TypoMaxLength: 10}, expectedValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, valid, err := ParseCodeAnnotations(tmpDir, tt.opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			if valid != tt.expectedValid {
+				t.Errorf("expected valid=%v, got %v", tt.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestParseCodeAnnotationsTypoSuggestions(t *testing.T) {
+	tests := map[string]struct {
+		prefix   string
+		comment  string
+		expected Typo
+	}{
+		"missing letter": {
+			comment:  "//no-escap",
+			expected: Typo{Comment: "//no-escap", Suggestion: "//no-escape", Distance: 3},
+		},
+		"missing dash": {
+			comment:  "//noescape-func",
+			expected: Typo{Comment: "//noescape-func", Suggestion: "//no-escape-func", Distance: 3},
+		},
+		"closer to no-inline than must-inline": {
+			comment:  "//no-inlin",
+			expected: Typo{Comment: "//no-inlin", Suggestion: "//no-inline", Distance: 3},
+		},
+		"tie broken by the order of the annotations": {
+			comment:  "//nt-inline",
+			expected: Typo{Comment: "//nt-inline", Suggestion: "//must-inline", Distance: 3},
+		},
+		"with prefix": {
+			prefix:   "escape:",
+			comment:  "//escape:no-aloc",
+			expected: Typo{Comment: "//escape:no-aloc", Suggestion: "//escape:no-alloc", Distance: 3},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := "package main\n\nvar a = 1 " + tt.comment + "\n"
+
+			var typos []Typo
+
+			opts := DefaultAnnotationOptions()
+			opts.Prefix = tt.prefix
+			opts.OnTypo = func(typo Typo) {
+				typos = append(typos, typo)
+			}
+
+			_, valid, err := parseFileAnnotations(strings.NewReader(src), "main.go", opts)
+			if err != nil {
+				t.Fatalf("parseFileAnnotations failed: %v", err)
+			}
+
+			// The typo is left to OnTypo, which reports it as a warning.
+			if !valid {
+				t.Error("expected the annotations to be valid")
+			}
+
+			tt.expected.Position = Position{File: absPath(t, "main.go"), Line: 3}
+
+			if !reflect.DeepEqual(typos, []Typo{tt.expected}) {
+				t.Errorf("expected %v, got %v", []Typo{tt.expected}, typos)
+			}
+		})
+	}
+}
+
+func TestParseCodeAnnotationsTypoLog(t *testing.T) {
+	var logs bytes.Buffer
+
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	src := "package main\n\nvar a = 1 //no-escpe\n"
+
+	if _, _, err := parseFileAnnotations(strings.NewReader(src), "x.go", DefaultAnnotationOptions()); err != nil {
+		t.Fatalf("parseFileAnnotations failed: %v", err)
+	}
+
+	expected := "probably a typo '//no-escpe' at x.go:3 (did you mean //no-escape?)"
+	if !strings.Contains(logs.String(), expected) {
+		t.Errorf("expected %q, got %q", expected, logs.String())
+	}
+}
+
+func TestTypoFinding(t *testing.T) {
+	typo := Typo{
+		Position:   Position{File: "main.go", Line: 3},
+		Comment:    "//no-escap",
+		Suggestion: "//no-escape",
+		Distance:   3,
+	}
+
+	finding := typo.Finding()
+
+	if finding.Severity != SeverityWarning || finding.Suggestion != "//no-escape" || finding.Distance != 3 {
+		t.Errorf("expected a warning suggesting //no-escape, got %+v", finding)
+	}
+
+	expected := "comment at main.go:3 is probably a misspelled annotation, did you mean //no-escape? (edit distance 3)"
+	if finding.String() != expected {
+		t.Errorf("expected %q, got %q", expected, finding.String())
+	}
+}
+
+func TestParseCodeAnnotationsPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	a := 1 //escape:no-escape
+	b := 2 //no-escape
+	c := 3 //nolint:ineffassign
+	d := 4 //escape:no-escap
+}
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		prefix        string
+		expected      map[Position][]Annotation
+		expectedValid bool
+	}{
+		{
+			name:          "prefixed",
+			prefix:        "escape:",
+			expected:      map[Position][]Annotation{{File: mainGoFile, Line: 5}: {{Kind: NoEscape, prefix: "escape:", Column: 9}}},
+			expectedValid: false,
+		},
+		{
+			name:          "bare",
+			expected:      map[Position][]Annotation{{File: mainGoFile, Line: 6}: {{Kind: NoEscape, Column: 9}}},
+			expectedValid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.Prefix = tt.prefix
+
+			results, valid, err := ParseCodeAnnotations(tmpDir, opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(results, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, results)
+			}
+
+			// Only the misspelled annotation with the prefix is a typo.
+			if valid != tt.expectedValid {
+				t.Errorf("expected valid=%v, got %v", tt.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestParseFileAnnotations(t *testing.T) {
+	tests := map[string]struct {
+		src      string
+		expected map[Position][]Annotation
+		valid    bool
+	}{
+		"several on a line": {
+			src: "package main\n\nvar a, b = new(int), new(int) //no-escape:a //no-heap-move:b\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 3}: {{Kind: NoEscape, Symbol: "a", Column: 31}, {Kind: NoHeapMove, Symbol: "b", Column: 31}},
+			},
+			valid: true,
+		},
+		"comment styles": {
+			src: "package main\n\n" +
+				"var a = new(int) //no-escape\n" +
+				"var b = new(int) // no-escape: hot path\n" +
+				"var c = new(int) /*no-escape*/\n" +
+				"var d = new(int) /* no-escape:d */ // no-heap-move\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 3}: {{Kind: NoEscape, Column: 18}},
+				{File: "main.go", Line: 4}: {{Kind: NoEscape, Reason: "hot path", Column: 18}},
+				{File: "main.go", Line: 5}: {{Kind: NoEscape, Column: 18}},
+				{File: "main.go", Line: 6}: {{Kind: NoEscape, Symbol: "d", Column: 18}, {Kind: NoHeapMove, Column: 18}},
+			},
+			valid: true,
+		},
+		"typo": {
+			src:      "package main\n\nvar a = new(int) //no-escap\n",
+			expected: map[Position][]Annotation{},
+			valid:    false,
+		},
+		"disabled line": {
+			src:      "package main\n\nvar a = new(int) //no-escape //escape-lint:disable-line\n",
+			expected: map[Position][]Annotation{},
+			valid:    true,
+		},
+		"function scope": {
+			src: "package main\n\nfunc f() { //no-alloc\n\t_ = new(int)\n}\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 3}: {{Kind: NoAlloc, EndLine: 5, Column: 12}},
+			},
+			valid: true,
+		},
+		"allocation budget": {
+			src: "package main\n\nfunc f() { //max-allocs=2\n\t_ = new(int)\n}\n\nfunc g() {} //max-allocs=two\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 3}: {{Kind: MaxAllocs, MaxAllocs: 2, EndLine: 5, Column: 12}},
+				{File: "main.go", Line: 7}: {{Kind: MaxAllocs, MaxAllocs: -1, EndLine: 7, Column: 13}},
+			},
+			valid: true,
+		},
+		"expected hint": {
+			src: "package main\n\nvar a = add(1, 2) //expect:inlined:add //expect:stays-on-stack: hot path\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 3}: {
+					{Kind: Expect, Hint: Inlined, Symbol: "add", Column: 19},
+					{Kind: Expect, Hint: StaysOnStack, Reason: "hot path", Column: 19},
+				},
+			},
+			valid: true,
+		},
+		"function declaration": {
+			src: "package main\n\nfunc (t *T) f() {} //must-inline\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 3}: {{Kind: MustInline, Func: "(*T).f", Column: 20}},
+			},
+			valid: true,
+		},
+		"region": {
+			src: "package main\n\nfunc f() {\n\t//no-escape-begin\n\t_ = new(int)\n\t//no-escape-end\n}\n",
+			expected: map[Position][]Annotation{
+				{File: "main.go", Line: 4}: {{Kind: NoEscapeBegin, EndLine: 6, Column: 2}},
+			},
+			valid: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			results, valid, err := parseFileAnnotations(strings.NewReader(tt.src), "main.go", DefaultAnnotationOptions())
+			if err != nil {
+				t.Fatalf("parseFileAnnotations failed: %v", err)
+			}
+
+			expected := make(map[Position][]Annotation, len(tt.expected))
+			for pos, anns := range tt.expected {
+				expected[Position{File: absPath(t, pos.File), Line: pos.Line}] = anns
+			}
+
+			if !reflect.DeepEqual(results, expected) {
+				t.Errorf("expected %v, got %v", expected, results)
+			}
+
+			if valid != tt.valid {
+				t.Errorf("expected valid to be %v, got %v", tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestParseAnnotationsArches(t *testing.T) {
+	tests := []struct {
+		comment  string
+		expected []Annotation
+	}{
+		{
+			comment:  "//no-bounds-check:amd64",
+			expected: []Annotation{{Kind: NoBoundsCheck, Arches: []string{"amd64"}}},
+		},
+		{
+			comment:  "//no-bounds-check:amd64,arm64: hot path",
+			expected: []Annotation{{Kind: NoBoundsCheck, Arches: []string{"amd64", "arm64"}, Reason: "hot path"}},
+		},
+		{
+			comment:  "//no-escape:hot path",
+			expected: []Annotation{{Kind: NoEscape, Reason: "hot path"}},
+		},
+		{
+			comment:  "//no-escape:amd64,sparc",
+			expected: []Annotation{{Kind: NoEscape, Reason: "amd64,sparc"}},
+		},
+		{
+			comment:  "//no-escape:buf //no-escape:tmp:arm64: scratch space",
+			expected: []Annotation{{Kind: NoEscape, Symbol: "buf"}, {Kind: NoEscape, Symbol: "tmp", Arches: []string{"arm64"}, Reason: "scratch space"}},
+		},
+		{
+			comment:  "//no-escape:buf:hot path",
+			expected: []Annotation{{Kind: NoEscape, Symbol: "buf", Reason: "hot path"}},
+		},
+		{
+			comment:  "//no-escape:allow: fixed in go1.23",
+			expected: []Annotation{{Kind: NoEscape, Allow: true, Reason: "fixed in go1.23"}},
+		},
+		{
+			comment:  "//no-escape:buf:allow",
+			expected: []Annotation{{Kind: NoEscape, Symbol: "buf", Allow: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.comment, func(t *testing.T) {
+			if result := parseAnnotations(tt.comment, ""); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	tests := []struct {
+		name            string
+		codeAnnotations map[Position][]Annotation
+		expectedValid   bool
+	}{
+		{
+			name: "compatible",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoEscape}, {Kind: MustInline}},
+				{File: "main.go", Line: 15}: {{Kind: NoInline}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "conflicting",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: MustInline}, {Kind: NoInline}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "reason",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoBoundsCheck, Reason: "hot, tight loop"}},
+				{File: "main.go", Line: 15}: {{Kind: NoBoundsCheck, Reason: "amd46"}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "budget",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: MaxAllocs, MaxAllocs: 0}},
+				{File: "main.go", Line: 15}: {{Kind: MaxAllocs, MaxAllocs: 3}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "missingBudget",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: MaxAllocs, MaxAllocs: -1}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "expectedHint",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: Expect, Hint: StaysOnStack}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "unknownHint",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: Expect, Hint: "stays-on-heap"}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "missingHint",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: Expect}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "namedBoundsCheck",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoBoundsCheck, Symbol: "amr64"}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "unknownArch",
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoBoundsCheck, Reason: "amd64,amr64: hot path"}},
+			},
+			expectedValid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if valid := ValidateAnnotations(tt.codeAnnotations); valid != tt.expectedValid {
+				t.Fatalf("expected %v, got %v", tt.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestParseCodeAnnotationsFieldSiteFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"point.go":      "package main\n\nvar sink *int\n\ntype point struct {\n\tx int //no-escape\n}\n",
+		"bench_test.go": "package main\n\nfunc leakTest() {\n\tp := point{}\n\tsink = &p.x\n}\n",
+		"purego.go":     "//go:build purego\n\npackage main\n\nfunc leakPure() {\n\tp := point{}\n\tsink = &p.x\n}\n",
+		"not_purego.go": "//go:build !purego\n\npackage main\n\nfunc leakAsm() {\n\tp := point{}\n\tsink = &p.x\n}\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	pos := Position{File: absPath(t, tmpDir, "point.go"), Line: 6}
+
+	// The sites are the variables whose field addresses are taken, searched
+	// in the same files as the annotations.
+	tests := map[string]struct {
+		includeTests bool
+		tags         []string
+		expected     []Position
+	}{
+		"all files": {
+			expected: []Position{
+				{File: absPath(t, tmpDir, "not_purego.go"), Line: 6},
+				{File: absPath(t, tmpDir, "purego.go"), Line: 6},
+			},
+		},
+		"tests": {
+			includeTests: true,
+			expected: []Position{
+				{File: absPath(t, tmpDir, "bench_test.go"), Line: 4},
+				{File: absPath(t, tmpDir, "not_purego.go"), Line: 6},
+				{File: absPath(t, tmpDir, "purego.go"), Line: 6},
+			},
+		},
+		"build tags": {
+			tags:     []string{"purego"},
+			expected: []Position{{File: absPath(t, tmpDir, "purego.go"), Line: 6}},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.IncludeTests = tt.includeTests
+			opts.Tags = tt.tags
+
+			annotations, _, err := ParseCodeAnnotations(tmpDir, opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			sites := slices.Clone(annotations[pos][0].Sites)
+			slices.SortFunc(sites, func(a, b Position) int { return strings.Compare(a.File, b.File) })
+
+			if !slices.Equal(sites, tt.expected) {
+				t.Errorf("expected the sites %v, got %v", tt.expected, sites)
+			}
+		})
+	}
+
+	// A file of the package that cannot be parsed fails rather than hiding
+	// the sites in it.
+	if err := os.WriteFile(filepath.Join(tmpDir, "broken.go"), []byte("package main\n\nfunc {\n"), 0644); err != nil {
+		t.Fatalf("failed to write broken.go: %v", err)
+	}
+
+	if _, _, err := ParseCodeAnnotations(filepath.Join(tmpDir, "point.go"), DefaultAnnotationOptions()); err == nil {
+		t.Errorf("expected an error for the unparsable file in the package")
+	}
+}
@@ -0,0 +1,106 @@
+package escapelint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	benchFiles        = 1000
+	benchLinesPerFile = 100
+)
+
+// benchMessages are the compiler messages repeated in the generated output,
+// including the ones that do not produce any hints.
+var benchMessages = []string{
+	"moved to heap: x",
+	"&x escapes to heap",
+	"make([]byte, 64) does not escape",
+	"inlining call to add",
+	"Found IsInBounds",
+	"can inline add",
+	"leaking param: p",
+	"x escapes to heap in leak:",
+}
+
+// writeBenchPackage generates a package of benchFiles files, each with a function
+// of benchLinesPerFile annotated lines, and the compiler output for it, one
+// message per line of code.
+func writeBenchPackage(b *testing.B) (dir, outputFile string) {
+	b.Helper()
+
+	dir = b.TempDir()
+
+	var output strings.Builder
+
+	for i := 0; i < benchFiles; i++ {
+		var src strings.Builder
+
+		fmt.Fprintf(&src, "package bench\n\nfunc f%d() {\n", i)
+
+		for j := 0; j < benchLinesPerFile; j++ {
+			fmt.Fprintf(&src, "\tx%d := %d //no-escape: generated\n", j, j)
+			fmt.Fprintf(&output, "./file%d.go:%d:2: %s\n", i, j+4, benchMessages[j%len(benchMessages)])
+		}
+
+		src.WriteString("}\n")
+
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.go", i)), []byte(src.String()), 0644); err != nil {
+			b.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	outputFile = filepath.Join(dir, "build.log")
+	if err := os.WriteFile(outputFile, []byte(output.String()), 0644); err != nil {
+		b.Fatalf("failed to write compiler output: %v", err)
+	}
+
+	return dir, outputFile
+}
+
+func BenchmarkParseCompilerOutput(b *testing.B) {
+	_, outputFile := writeBenchPackage(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseCompilerOutput(outputFile); err != nil {
+			b.Fatalf("ParseCompilerOutput failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkParseCodeAnnotations(b *testing.B) {
+	dir, _ := writeBenchPackage(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ParseCodeAnnotations(dir, DefaultAnnotationOptions()); err != nil {
+			b.Fatalf("ParseCodeAnnotations failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkCompareResults(b *testing.B) {
+	dir, outputFile := writeBenchPackage(b)
+
+	hints, err := ParseCompilerOutput(outputFile)
+	if err != nil {
+		b.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations(dir, DefaultAnnotationOptions())
+	if err != nil {
+		b.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		CompareResults(hints, annotations, CompareOptions{})
+	}
+}
@@ -0,0 +1,102 @@
+package escapelint
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultGCFlags enable the compiler diagnostics needed to check all annotations.
+const DefaultGCFlags = "-m -d=ssa/check_bce"
+
+// hasEscapeFlag reports whether the compiler flags enable the escape analysis
+// diagnostics with -m at any level, spelled as "-m", "-m -m" or "-m=2", possibly
+// only for the packages matching a pattern, as in "./hot/...=-m".
+func hasEscapeFlag(gcflags string) bool {
+	for _, flag := range strings.Fields(gcflags) {
+		if pattern, flags, ok := strings.Cut(flag, "="); ok && !strings.HasPrefix(pattern, "-") {
+			flag = flags
+		}
+
+		if flag == "-m" || strings.HasPrefix(flag, "-m=") && flag != "-m=0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunCompiler builds the package with the compiler diagnostics enabled and parses
+// its output. The package path is either a directory, which is built along with
+// its subpackages, or a single file. Nothing is written, since the binary is
+// discarded, while the build cache keeps repeated runs fast. The gcflags are
+// passed to the compiler as they are, DefaultGCFlags are used if empty. The build
+// tags, if any, select the files to build.
+func RunCompiler(packagePath, gcflags string, tags []string) (map[Position][]Hint, error) {
+	if gcflags == "" {
+		gcflags = DefaultGCFlags
+	}
+
+	if !hasEscapeFlag(gcflags) {
+		log.Printf("warning: -gcflags %q do not include -m, so the compiler reports no escape analysis or inlining", gcflags)
+	}
+
+	info, err := os.Stat(packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, target := packagePath, "./..."
+	if !info.IsDir() {
+		dir, target = filepath.Dir(packagePath), filepath.Base(packagePath)
+	}
+
+	args := []string{"build", "-gcflags=" + gcflags, "-o", os.DevNull}
+	if len(tags) > 0 {
+		args = append(args, "-tags="+strings.Join(tags, ","))
+	}
+
+	cmd := exec.Command("go", append(args, target)...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("go build failed: %w\n%s", err, output)
+	}
+
+	results := make(map[Position][]Hint)
+	if err := parseCompilerReader(bytes.NewReader(output), dir, results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ResolvePackageDir returns the directory of the package given by its import
+// path, e.g. "github.com/me/proj/pkg/hot", as reported by go list in the
+// working directory. A path that exists on disk is returned as it is, and so is
+// one that cannot be resolved, so that it fails as a missing path later.
+func ResolvePackageDir(pkg string) string {
+	if _, err := os.Stat(pkg); err == nil || filepath.IsAbs(pkg) {
+		return pkg
+	}
+
+	output, err := exec.Command("go", "list", "-f", "{{.Dir}}", "--", pkg).Output()
+	if err != nil {
+		debugf("cannot resolve %s as an import path: %v", pkg, err)
+		return pkg
+	}
+
+	dir := strings.TrimSpace(string(output))
+	if dir == "" || strings.Contains(dir, "\n") {
+		return pkg
+	}
+
+	debugf("resolved %s to %s", pkg, dir)
+
+	return dir
+}
@@ -0,0 +1,153 @@
+package escapelint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunCompiler(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the build in short mode")
+	}
+
+	for _, packagePath := range []string{"testdata/example", "testdata/example/main.go"} {
+		t.Run(packagePath, func(t *testing.T) {
+			hints, err := RunCompiler(packagePath, "", nil)
+			if err != nil {
+				t.Fatalf("RunCompiler failed: %v", err)
+			}
+
+			mainGo := absPath(t, "testdata", "example", "main.go")
+
+			if h := hints[Position{File: mainGo, Line: 8}]; !hasHint(h, MovedToHeap) {
+				t.Errorf("expected %s at line 8, got %v", MovedToHeap, h)
+			}
+
+			if h := hints[Position{File: mainGo, Line: 14}]; !hasHint(h, Inlined) {
+				t.Errorf("expected %s at line 14, got %v", Inlined, h)
+			}
+		})
+	}
+}
+
+func TestRunCompilerGCFlags(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go command is a shell script")
+	}
+
+	// A fake go command records its arguments and prints a diagnostic.
+	binDir := t.TempDir()
+	argsFile := filepath.Join(binDir, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\necho './main.go:8:2: moved to heap: x' >&2\n"
+
+	if err := os.WriteFile(filepath.Join(binDir, "go"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake go: %v", err)
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	hints, err := RunCompiler("testdata/example", "-m -l=4", []string{"purego", "debug"})
+	if err != nil {
+		t.Fatalf("RunCompiler failed: %v", err)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("fake go was not run: %v", err)
+	}
+
+	expected := []string{"build", "-gcflags=-m -l=4", "-o", os.DevNull, "-tags=purego,debug", "./..."}
+	if got := strings.Split(strings.TrimSpace(string(args)), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected arguments %q, got %q", expected, got)
+	}
+
+	if h := hints[Position{File: absPath(t, "testdata", "example", "main.go"), Line: 8}]; !hasHint(h, MovedToHeap) {
+		t.Errorf("expected %s at line 8, got %v", MovedToHeap, h)
+	}
+}
+
+func TestHasEscapeFlag(t *testing.T) {
+	tests := map[string]bool{
+		"-m":                     true,
+		"-m -m":                  true,
+		"-m=2 -l":                true,
+		"./hot/...=-m":           true,
+		"all=-m=2":               true,
+		"-m=0":                   false,
+		"all=-N -l":              false,
+		"-d=ssa/check_bce":       false,
+		"-l=4 -d=ssa/check_bce ": false,
+	}
+
+	for gcflags, expected := range tests {
+		if got := hasEscapeFlag(gcflags); got != expected {
+			t.Errorf("expected %t for %q, got %t", expected, gcflags, got)
+		}
+	}
+}
+
+func TestResolvePackageDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go list in short mode")
+	}
+
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+
+	files := map[string]string{
+		"go.mod":     "module example.com/small\n\ngo 1.22\n",
+		"hot/hot.go": "package hot\n\nvar a = new(int) //no-escape\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	tests := map[string]string{
+		"example.com/small/hot":     filepath.Join(tmpDir, "hot"),
+		"hot":                       "hot",
+		"example.com/small/missing": "example.com/small/missing",
+	}
+
+	for pkg, expected := range tests {
+		if dir := ResolvePackageDir(pkg); dir != expected {
+			t.Errorf("expected %s to resolve to %s, got %s", pkg, expected, dir)
+		}
+	}
+
+	annotations, _, err := ParseCodeAnnotations(ResolvePackageDir("example.com/small/hot"), DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	if len(annotations[Position{File: filepath.Join(tmpDir, "hot", "hot.go"), Line: 3}]) != 1 {
+		t.Errorf("expected an annotation in the resolved package, got %v", annotations)
+	}
+}
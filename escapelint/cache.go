@@ -0,0 +1,164 @@
+package escapelint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CacheDirName is the directory of the annotation cache used by the command
+// line tool, in the package directory. The walk skips it like any other hidden
+// directory.
+const CacheDirName = ".escape-lint-cache"
+
+// cacheVersion is part of every cache key. It must be changed along with the
+// parsing of the annotations or the format of the entries, so that the entries
+// written by older versions are not used.
+const cacheVersion = 1
+
+// cacheEntry holds the annotations parsed from a single source file. Every file
+// has one entry, which is replaced when the content of the file changes.
+type cacheEntry struct {
+	Version int         `json:"version"`
+	Hash    string      `json:"hash"` // of the content of the file
+	Lines   []cacheLine `json:"lines"`
+}
+
+type cacheLine struct {
+	Line        int          `json:"line"`
+	Annotations []Annotation `json:"annotations"`
+}
+
+// cacheKey names the entry of the file. Besides the path, it depends on the
+// options and the custom annotations affecting the parsing, so that the runs
+// with different ones do not share the entries.
+func cacheKey(filename string, opts AnnotationOptions) string {
+	h := sha256.New()
+
+	_, _ = fmt.Fprintf(h, "%d\n%s\n", cacheVersion, normalizePath(filename))
+	_, _ = fmt.Fprintf(h, "%q %d %d %t %t %t\n", opts.Prefix, opts.TypoDistance, opts.TypoMaxLength,
+		opts.SkipGenerated, opts.StatementSpan, opts.RejectCodeless)
+
+	registryMu.RLock()
+	for _, kind := range knownAnnotations {
+		_, _ = fmt.Fprintf(h, "%s\n", kind)
+	}
+	registryMu.RUnlock()
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func contentHash(src []byte) string {
+	sum := sha256.Sum256(src)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseCachedFile parses the annotations of the file, or takes them from the
+// cache if the file has not changed since they were stored. Only the files
+// without any errors or warnings are cached, so that the problems are logged
+// on every run. The cache is only an optimization, so failing to read or write
+// it is not an error.
+func parseCachedFile(filename string, opts AnnotationOptions) (map[Position][]Annotation, bool, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if opts.CacheDir == "" {
+		annotations, valid, _, err := parseSource(src, filename, opts)
+		return annotations, valid, err
+	}
+
+	key, hash := cacheKey(filename, opts), contentHash(src)
+
+	if annotations, ok := readCacheEntry(opts.CacheDir, key, hash, filename, opts.Prefix); ok {
+		debugf("using cached annotations of %s", filename)
+		return annotations, true, nil
+	}
+
+	annotations, valid, warned, err := parseSource(src, filename, opts)
+	if err != nil || !valid || warned {
+		return annotations, valid, err
+	}
+
+	if err := writeCacheEntry(opts.CacheDir, key, hash, annotations); err != nil {
+		debugf("failed to cache the annotations of %s: %s", filename, err)
+	}
+
+	return annotations, valid, nil
+}
+
+// readCacheEntry returns the annotations of the file stored under the key, if
+// the entry is there and the content hash matches.
+func readCacheEntry(dir, key, hash, filename, prefix string) (map[Position][]Annotation, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		debugf("ignoring corrupted cache entry for %s: %s", filename, err)
+		return nil, false
+	}
+
+	if entry.Version != cacheVersion || entry.Hash != hash {
+		return nil, false
+	}
+
+	file := normalizePath(filename)
+	annotations := make(map[Position][]Annotation, len(entry.Lines))
+
+	for _, line := range entry.Lines {
+		for i := range line.Annotations {
+			line.Annotations[i].prefix = prefix
+		}
+
+		annotations[Position{File: file, Line: line.Line}] = line.Annotations
+	}
+
+	return annotations, true
+}
+
+// writeCacheEntry stores the annotations of a file under the key. The entry is
+// written to a temporary file first and renamed, so that concurrent runs, e.g.
+// in watch mode and from the editor, never read a partial entry.
+func writeCacheEntry(dir, key, hash string, annotations map[Position][]Annotation) error {
+	entry := cacheEntry{Version: cacheVersion, Hash: hash}
+
+	for pos, anns := range annotations {
+		entry.Lines = append(entry.Lines, cacheLine{Line: pos.Line, Annotations: anns})
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, key+".json"))
+}
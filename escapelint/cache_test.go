@@ -0,0 +1,175 @@
+package escapelint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func cacheEntries(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatalf("failed to list the cache entries: %v", err)
+	}
+
+	return entries
+}
+
+func TestParseCodeAnnotationsCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, CacheDirName)
+
+	mainGo := filepath.Join(tmpDir, "main.go")
+	writeSource := func(src string) {
+		t.Helper()
+
+		if err := os.WriteFile(mainGo, []byte(src), 0644); err != nil {
+			t.Fatalf("failed to write to main.go: %v", err)
+		}
+	}
+
+	writeSource("package main\n\nfunc f() { //no-alloc\n\tx := new(int) //no-escape:x\n\t_ = x\n}\n")
+
+	opts := DefaultAnnotationOptions()
+	opts.CacheDir = cacheDir
+
+	expected, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil || !valid {
+		t.Fatalf("ParseCodeAnnotations failed: %v (valid=%v)", err, valid)
+	}
+
+	parse := func() map[Position][]Annotation {
+		t.Helper()
+
+		annotations, valid, err := ParseCodeAnnotations(tmpDir, opts)
+		if err != nil || !valid {
+			t.Fatalf("ParseCodeAnnotations failed: %v (valid=%v)", err, valid)
+		}
+
+		return annotations
+	}
+
+	t.Run("miss", func(t *testing.T) {
+		if annotations := parse(); !reflect.DeepEqual(annotations, expected) {
+			t.Errorf("expected %v, got %v", expected, annotations)
+		}
+
+		if entries := cacheEntries(t, cacheDir); len(entries) != 1 {
+			t.Errorf("expected an entry for main.go, got %v", entries)
+		}
+	})
+
+	t.Run("hit", func(t *testing.T) {
+		// The entry is replaced with different annotations for the same
+		// content, which are returned as they are.
+		src, err := os.ReadFile(mainGo)
+		if err != nil {
+			t.Fatalf("failed to read main.go: %v", err)
+		}
+
+		cached := map[Position][]Annotation{{File: mainGo, Line: 4}: {{Kind: NoHeapMove, Column: 17}}}
+		if err := writeCacheEntry(cacheDir, cacheKey(mainGo, opts), contentHash(src), cached); err != nil {
+			t.Fatalf("writeCacheEntry failed: %v", err)
+		}
+
+		expected := map[Position][]Annotation{{File: absPath(t, mainGo), Line: 4}: {{Kind: NoHeapMove, Column: 17}}}
+		if annotations := parse(); !reflect.DeepEqual(annotations, expected) {
+			t.Errorf("expected the cached %v, got %v", expected, annotations)
+		}
+	})
+
+	t.Run("invalidation", func(t *testing.T) {
+		writeSource("package main\n\nfunc f() {\n\tx := new(int) //no-heap-escape\n\t_ = x\n}\n")
+
+		expected := map[Position][]Annotation{{File: absPath(t, mainGo), Line: 4}: {{Kind: NoHeapEscape, Column: 16}}}
+		if annotations := parse(); !reflect.DeepEqual(annotations, expected) {
+			t.Errorf("expected %v, got %v", expected, annotations)
+		}
+
+		// The entry of the file is replaced rather than added.
+		if entries := cacheEntries(t, cacheDir); len(entries) != 1 {
+			t.Errorf("expected a single entry for main.go, got %v", entries)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		prefixed := opts
+		prefixed.Prefix = "escape:"
+
+		annotations, _, err := ParseCodeAnnotations(tmpDir, prefixed)
+		if err != nil {
+			t.Fatalf("ParseCodeAnnotations failed: %v", err)
+		}
+
+		if len(annotations) != 0 {
+			t.Errorf("expected no annotations with a prefix, got %v", annotations)
+		}
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		for _, entry := range cacheEntries(t, cacheDir) {
+			if err := os.WriteFile(entry, []byte("{"), 0644); err != nil {
+				t.Fatalf("failed to corrupt %s: %v", entry, err)
+			}
+		}
+
+		expected := map[Position][]Annotation{{File: absPath(t, mainGo), Line: 4}: {{Kind: NoHeapEscape, Column: 16}}}
+		if annotations := parse(); !reflect.DeepEqual(annotations, expected) {
+			t.Errorf("expected %v, got %v", expected, annotations)
+		}
+	})
+}
+
+func TestParseCodeAnnotationsCacheWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, CacheDirName)
+
+	// The warning about the annotation on a line without code would not be
+	// logged again if the file was cached.
+	src := "package main\n\n//no-escape\nvar x = new(int)\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	opts := DefaultAnnotationOptions()
+	opts.CacheDir = cacheDir
+
+	if _, _, err := ParseCodeAnnotations(tmpDir, opts); err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	if entries := cacheEntries(t, cacheDir); len(entries) != 0 {
+		t.Errorf("expected no entries for a file with warnings, got %v", entries)
+	}
+}
+
+func TestParseCodeAnnotationsCacheTypos(t *testing.T) {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, CacheDirName)
+
+	src := "package main\n\nvar x = 1 //no-escap\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	typos := 0
+
+	opts := DefaultAnnotationOptions()
+	opts.CacheDir = cacheDir
+	opts.OnTypo = func(Typo) { typos++ }
+
+	// The typo is reported on every run, rather than only before the file
+	// is cached.
+	for range 2 {
+		if _, valid, err := ParseCodeAnnotations(tmpDir, opts); err != nil || !valid {
+			t.Fatalf("ParseCodeAnnotations failed: %v (valid=%v)", err, valid)
+		}
+	}
+
+	if typos != 2 {
+		t.Errorf("expected the typo to be reported twice, got %d", typos)
+	}
+}
@@ -0,0 +1,336 @@
+package escapelint
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Checker verifies the annotations of one kind against the compiler output.
+// The built-in annotations are checked by the same interface, and custom ones
+// can be added with RegisterChecker, e.g. for project-specific assertions.
+type Checker interface {
+	// Check returns the findings about the annotation, or none if it holds.
+	// It is only called for the annotations that matched compiler output,
+	// since the stale ones are reported by CompareResults.
+	Check(target Target) []Finding
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc func(target Target) []Finding
+
+func (f CheckerFunc) Check(target Target) []Finding {
+	return f(target)
+}
+
+// Target is an annotation to check, along with the compiler output.
+type Target struct {
+	Position   Position
+	Annotation Annotation
+
+	// Hints are the compiler hints at the lines of the annotation, and at the
+	// sites of a struct field. They are narrowed down to the ones about the
+	// symbol of a named annotation.
+	Hints []Hint
+
+	// AllHints are the hints at every position, for the checks looking beyond
+	// the annotated line, such as the ones of a whole function.
+	AllHints map[Position][]Hint
+
+	Options CompareOptions
+}
+
+// Failure returns an error about the annotation, at its position.
+func (t Target) Failure(subject, message string) Finding {
+	return Finding{
+		Position:   t.Position,
+		Annotation: t.Annotation,
+		Severity:   SeverityError,
+		Subject:    subject,
+		Message:    message,
+		Column:     t.Annotation.Column,
+	}
+}
+
+// failures returns the finding as a list, which is the shape most of the
+// built-in checks return.
+func (t Target) failures(subject, message string) []Finding {
+	return []Finding{t.Failure(subject, message)}
+}
+
+// checkers maps the built-in annotations to their checks. The registered ones
+// are kept apart, so that the built-ins cannot be unregistered, and the custom
+// rules are looked up separately, since they share a single implementation.
+var checkers = map[AnnotationKind]Checker{
+	NoEscape:      CheckerFunc(checkNoEscape),
+	NoEscapeFunc:  CheckerFunc(checkFuncEscapes),
+	NoAlloc:       CheckerFunc(checkNoAlloc),
+	NoEscapeBegin: CheckerFunc(checkFuncEscapes),
+	MaxAllocs:     CheckerFunc(checkMaxAllocs),
+	Expect:        CheckerFunc(checkExpect),
+	NoHeapMove:    CheckerFunc(checkNoHeapMove),
+	NoHeapEscape:  CheckerFunc(checkNoHeapEscape),
+	StackAlloc:    CheckerFunc(checkStackAlloc),
+	NoBoundsCheck: CheckerFunc(checkNoBoundsCheck),
+	MustInline:    CheckerFunc(checkMustInline),
+	AlwaysInlined: CheckerFunc(checkAlwaysInlined),
+	NoInline:      CheckerFunc(checkNoInline),
+}
+
+var customCheckers = make(map[AnnotationKind]Checker)
+
+// RegisterChecker adds a custom annotation checked by the checker. Like the
+// rules, it must be called before the source code is parsed, since the comments
+// parsed before are not recognized as the annotation. It is safe to call
+// concurrently with the parsing, which then sees either all of the annotation
+// or none of it.
+func RegisterChecker(kind AnnotationKind, checker Checker) error {
+	if err := validAnnotationName(kind); err != nil {
+		return err
+	}
+
+	if checker == nil {
+		return fmt.Errorf("checker is required for %s", kind)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if slices.Contains(knownAnnotations, kind) {
+		return fmt.Errorf("annotation already exists: %s", kind)
+	}
+
+	knownAnnotations = append(knownAnnotations, kind)
+	customCheckers[kind] = checker
+
+	return nil
+}
+
+// UnregisterChecker removes an annotation added by RegisterChecker, e.g. when a
+// test is done with it. The built-in annotations and the unknown ones are left
+// as they are.
+func UnregisterChecker(kind AnnotationKind) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := customCheckers[kind]; ok {
+		delete(customCheckers, kind)
+		removeAnnotation(kind)
+	}
+}
+
+// lookupChecker returns the checker of the annotation kind, either a built-in
+// or a registered one, or a custom rule.
+func lookupChecker(kind AnnotationKind) (Checker, bool) {
+	if checker, ok := checkers[kind]; ok {
+		return checker, true
+	}
+
+	registryMu.RLock()
+	checker, ok := customCheckers[kind]
+	registryMu.RUnlock()
+
+	if ok {
+		return checker, true
+	}
+
+	if rule, ok := lookupRule(kind); ok {
+		return rule, true
+	}
+
+	return nil, false
+}
+
+// checkNoEscape only looks for the hints of values on the heap. The ones saying
+// that the value stays on stack or does not escape need no check beyond the
+// annotation being matched.
+func checkNoEscape(t Target) []Finding {
+	// A parameter or a receiver leaking to the heap is reported at the
+	// function declaration rather than where it is stored.
+	if hasHint(t.Hints, EscapesToHeap, MovedToHeap, LeakingParam) {
+		return t.failures("variable", fmt.Sprintf("is marked as %s but escapes to heap", t.Annotation))
+	}
+
+	return nil
+}
+
+// checkFuncEscapes checks the annotations of a whole function or region, where
+// every escaping line is reported on its own, so that they can be fixed one by
+// one.
+func checkFuncEscapes(t Target) []Finding {
+	ann := t.Annotation
+
+	subject, message := "variable", fmt.Sprintf("is in a function marked as %s but escapes to heap", ann)
+	if ann.Kind == NoEscapeBegin {
+		message = fmt.Sprintf("is in a region marked as %s but escapes to heap", ann)
+	}
+
+	var findings []Finding
+
+	for line := t.Position.Line; line <= ann.EndLine; line++ {
+		linePos := Position{File: t.Position.File, Line: line}
+
+		if !hasHint(t.AllHints[linePos], EscapesToHeap, MovedToHeap) {
+			continue
+		}
+
+		finding := t.Failure(subject, message)
+		finding.Position = linePos
+
+		if line != t.Position.Line {
+			finding.Column = 0
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// checkNoAlloc reports every heap allocation of the function on its own, with
+// the allocated value, so that a line allocating twice is reported twice, while
+// no-escape-func reports the escaping lines.
+func checkNoAlloc(t Target) []Finding {
+	ann := t.Annotation
+
+	var findings []Finding
+
+	for line := t.Position.Line; line <= ann.EndLine; line++ {
+		linePos := Position{File: t.Position.File, Line: line}
+
+		for _, hint := range t.AllHints[linePos] {
+			if !isAllocation(hint) {
+				continue
+			}
+
+			subject := "heap allocation"
+			if hint.Symbol != "" {
+				subject = fmt.Sprintf("heap allocation of %s", hint.Symbol)
+			}
+
+			finding := t.Failure(subject, fmt.Sprintf("is in a function marked as %s", ann))
+			finding.Position = linePos
+
+			if line != t.Position.Line {
+				finding.Column = 0
+			}
+
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
+
+// isAllocation reports whether the hint is about a value allocated on the heap,
+// either escaping or moved there, including the make calls.
+func isAllocation(h Hint) bool {
+	return h.Kind == EscapesToHeap || h.Kind == MovedToHeap
+}
+
+// checkMaxAllocs counts the allocations of the function like no-alloc, but the
+// function is reported once rather than at every allocation.
+func checkMaxAllocs(t Target) []Finding {
+	allocs := 0
+
+	for line := t.Position.Line; line <= t.Annotation.EndLine; line++ {
+		for _, hint := range t.AllHints[Position{File: t.Position.File, Line: line}] {
+			if isAllocation(hint) {
+				allocs++
+			}
+		}
+	}
+
+	if allocs > t.Annotation.MaxAllocs {
+		return t.failures("function", fmt.Sprintf("is marked as %s but has %d heap allocations", t.Annotation, allocs))
+	}
+
+	return nil
+}
+
+// checkExpect requires the exact hint, without any interpretation of what it
+// means for the annotated value.
+func checkExpect(t Target) []Finding {
+	if !hasHint(t.Hints, t.Annotation.Hint) {
+		return t.failures("line", fmt.Sprintf("is marked as %s but the compiler reports no %s", t.Annotation, t.Annotation.Hint))
+	}
+
+	return nil
+}
+
+func checkNoHeapMove(t Target) []Finding {
+	if hasHint(t.Hints, MovedToHeap) {
+		return t.failures("variable", fmt.Sprintf("is marked as %s but is moved to heap", t.Annotation))
+	}
+
+	return nil
+}
+
+func checkNoHeapEscape(t Target) []Finding {
+	if hasHint(t.Hints, EscapesToHeap) {
+		return t.failures("variable", fmt.Sprintf("is marked as %s but escapes to heap", t.Annotation))
+	}
+
+	return nil
+}
+
+// checkStackAlloc only takes the outcome of the make calls as positive evidence
+// of a stack allocation, other values on the line do not count.
+func checkStackAlloc(t Target) []Finding {
+	if i := slices.IndexFunc(t.Hints, isHeapMake); i >= 0 {
+		return t.failures("allocation", fmt.Sprintf("is marked as %s but %s escapes to heap", t.Annotation, t.Hints[i].Symbol))
+	}
+
+	if !slices.ContainsFunc(t.Hints, isStackMake) {
+		return t.failures("allocation", fmt.Sprintf("is marked as %s but no make is reported to stay on stack", t.Annotation))
+	}
+
+	return nil
+}
+
+func checkNoBoundsCheck(t Target) []Finding {
+	if hasHintNearby(t.AllHints, t.Position, t.Options.BCEWindow, FoundIsInBounds) {
+		return t.failures("variable", fmt.Sprintf("is marked as %s but bounds check is not eliminated", t.Annotation))
+	}
+
+	return nil
+}
+
+// checkMustInline accepts the function being inlinable at its declaration,
+// even if it is not called anywhere.
+func checkMustInline(t Target) []Finding {
+	if !hasHint(t.Hints, Inlined) && (t.Annotation.Func == "" || !hasHint(t.Hints, CanInline)) {
+		return t.failures("function", fmt.Sprintf("is marked as %s but is not inlined%s", t.Annotation, inlineCost(t.Hints)))
+	}
+
+	return nil
+}
+
+func checkAlwaysInlined(t Target) []Finding {
+	if !hasHint(t.Hints, Inlined) {
+		return t.failures("function", fmt.Sprintf("is marked as %s but is not inlined at any call site%s", t.Annotation, inlineCost(t.Hints)))
+	}
+
+	return nil
+}
+
+func checkNoInline(t Target) []Finding {
+	if hasHint(t.Hints, Inlined) {
+		return t.failures("function", fmt.Sprintf("is marked as %s but was inlined", t.Annotation))
+	}
+
+	return nil
+}
+
+// Check requires or forbids a compiler message matching the rule at the
+// annotated line.
+func (r Rule) Check(t Target) []Finding {
+	if hasHint(t.Hints, r.hint()) == r.Present {
+		return nil
+	}
+
+	if r.Present {
+		return t.failures("line", fmt.Sprintf("is marked as %s but has no compiler output matching %q", t.Annotation, r.Pattern))
+	}
+
+	return t.failures("line", fmt.Sprintf("is marked as %s but has compiler output matching %q", t.Annotation, r.Pattern))
+}
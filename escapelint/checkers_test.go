@@ -0,0 +1,135 @@
+package escapelint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func registerTestChecker(t *testing.T, kind AnnotationKind, checker Checker) {
+	t.Helper()
+
+	if err := RegisterChecker(kind, checker); err != nil {
+		t.Fatalf("RegisterChecker failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		UnregisterChecker(kind)
+	})
+}
+
+func TestCustomChecker(t *testing.T) {
+	// Forbids passing values to interface parameters on the line, which the
+	// compiler reports as the arguments of the call escaping or not.
+	registerTestChecker(t, "no-boxing", CheckerFunc(func(target Target) []Finding {
+		for _, hint := range target.Hints {
+			if hint.Kind == EscapesToHeap && strings.HasPrefix(hint.Symbol, "...") {
+				return []Finding{target.Failure("call", fmt.Sprintf("is marked as %s but boxes its arguments", target.Annotation))}
+			}
+		}
+
+		return nil
+	}))
+
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	fmt.Println(x) //no-boxing
+	fmt.Println(y) //no-boxing
+	_ = new(int)   //no-escape
+}
+`
+	compilerOutput := `
+./main.go:5:13: ... argument escapes to heap
+./main.go:6:13: ... argument does not escape
+./main.go:7:9: new(int) escapes to heap
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	buildLog := filepath.Join(tmpDir, "build.log")
+	if err := os.WriteFile(buildLog, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to build.log: %v", err)
+	}
+
+	hints, err := ParseCompilerOutput(buildLog)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil || !valid {
+		t.Fatalf("ParseCodeAnnotations failed: %v (valid=%v)", err, valid)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The custom checker runs along with the built-in ones.
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	expected := []string{
+		fmt.Sprintf("call at %s:5 is marked as no-boxing but boxes its arguments", mainGoFile),
+		fmt.Sprintf("variable at %s:7 is marked as no-escape but escapes to heap", mainGoFile),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+
+	if stats := report.Kinds["no-boxing"]; stats.Passed != 1 || stats.Failed != 1 {
+		t.Errorf("expected 1 passed and 1 failed, got %+v", stats)
+	}
+}
+
+func TestUnregisterChecker(t *testing.T) {
+	checker := CheckerFunc(func(Target) []Finding { return nil })
+
+	if err := RegisterChecker("no-boxing", checker); err != nil {
+		t.Fatalf("RegisterChecker failed: %v", err)
+	}
+
+	UnregisterChecker("no-boxing")
+
+	if _, ok := lookupChecker("no-boxing"); ok || IsKnownAnnotation("no-boxing") {
+		t.Errorf("expected no-boxing to be removed")
+	}
+
+	// The built-in annotations stay.
+	UnregisterChecker(NoEscape)
+
+	if _, ok := lookupChecker(NoEscape); !ok || !IsKnownAnnotation(NoEscape) {
+		t.Errorf("expected %s to stay", NoEscape)
+	}
+}
+
+func TestRegisterCheckerErrors(t *testing.T) {
+	checker := CheckerFunc(func(Target) []Finding { return nil })
+
+	tests := []struct {
+		kind    AnnotationKind
+		checker Checker
+	}{
+		{kind: "", checker: checker},
+		{kind: "no boxing", checker: checker},
+		{kind: "max=1", checker: checker},
+		{kind: NoEscape, checker: checker},
+		{kind: "no-boxing"},
+	}
+
+	for _, tt := range tests {
+		if err := RegisterChecker(tt.kind, tt.checker); err == nil {
+			t.Errorf("expected an error for %q", tt.kind)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package escapelint
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding describes an annotation that is not satisfied by the compiler output.
+type Finding struct {
+	Position   Position
+	Annotation Annotation
+	Severity   Severity
+	Subject    string // what the annotation refers to, e.g. "variable" or "function"
+	Message    string // what went wrong, without the subject and the position
+	Snippet    string // trimmed source line at the position, if available
+	Stale      bool   // the annotation matched no compiler hints
+	Column     int    // column of the annotation comment, if the finding is at its line
+	Suggestion string // replacement of a comment that is probably a misspelled annotation
+	Distance   int    // edit distance between the comment and the suggestion
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s at %s:%d %s", f.Subject, f.Position.File, f.Position.Line, f.Message)
+}
+
+// Report is the outcome of comparing code annotations with compiler hints.
+type Report struct {
+	Findings  []Finding
+	Checked   int // number of annotations evaluated
+	Unmatched int // number of annotations whose position has no compiler hints at all
+	Allowed   int // number of annotations marked with :allow that are not satisfied
+	Skipped   int // number of annotations in the packages without compiler output, which are not checked
+
+	// Uninstrumented lists the directories of the packages with annotations but
+	// without any compiler hints, e.g. when -m was only enabled for some packages
+	// with -gcflags=pattern=-m. The annotations in these packages are not checked.
+	// The packages left out of CompareOptions.Instrumented are not listed.
+	Uninstrumented []string
+
+	// Kinds breaks down the checked and unmatched annotations by kind. A kind
+	// that never matches any hints is likely misconfigured, e.g. bounds checks
+	// are not reported without -d=ssa/check_bce.
+	Kinds map[AnnotationKind]KindStats
+}
+
+// KindStats counts the annotations of a single kind. Every checked annotation
+// has exactly one verdict: passed, failed, allowed or stale.
+type KindStats struct {
+	Checked   int
+	Unmatched int
+	Passed    int
+	Failed    int
+	Allowed   int // failed, but marked with :allow
+	Stale     int // matched no compiler output, or none about its symbol
+}
+
+// Errors returns the number of findings with the error severity.
+func (r Report) Errors() int {
+	n := 0
+
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (r Report) Valid() bool {
+	return r.Errors() == 0
+}
+
+func (r Report) Summary() string {
+	files := make(map[string]struct{})
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			files[f.Position.File] = struct{}{}
+		}
+	}
+
+	summary := fmt.Sprintf(
+		"%s across %s (%s checked, %d matched no compiler hints",
+		plural(r.Errors(), "failure"),
+		plural(len(files), "file"),
+		plural(r.Checked, "annotation"),
+		r.Unmatched,
+	)
+
+	if r.Allowed > 0 {
+		summary += fmt.Sprintf(", %d allowed", r.Allowed)
+	}
+
+	if r.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", r.Skipped)
+	}
+
+	return summary + ")"
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+type CompareOptions struct {
+	// Strict turns warnings about annotations that matched no compiler
+	// hints into errors.
+	Strict bool
+
+	// GOARCH is the architecture the compiler output was produced for.
+	// Annotations qualified with other architectures are skipped.
+	GOARCH string
+
+	// BCEWindow is the number of lines around a no-bounds-check annotation
+	// where bounds checks are also considered, since they may be reported
+	// at a neighboring line after inlining.
+	BCEWindow int
+
+	// Enabled limits the checked annotations to the given kinds, so that
+	// they can be enforced one at a time. All of them are checked if empty.
+	Enabled []AnnotationKind
+
+	// IgnorePathCase matches the files of the compiler output and of the
+	// annotations regardless of the case of their paths, which may differ on
+	// case-insensitive filesystems, e.g. Main.go and main.go on macOS.
+	IgnorePathCase bool
+
+	// Instrumented lists the directories of the packages built with -m, e.g.
+	// with -gcflags=pattern=-m, and a directory ending with /... also covers its
+	// subdirectories, as in the package patterns of go build. The annotations
+	// of the other packages are skipped without a warning, while the ones of
+	// these packages are checked even if they have no compiler hints at all.
+	// If empty, the packages with any compiler hints are taken as instrumented.
+	Instrumented []string
+
+	// Typos are the comments found by ParseCodeAnnotations that are probably
+	// misspelled annotations. They are reported as warnings along with the
+	// other findings.
+	Typos []Typo
+}
+
+func CompareResults(
+	compilerHints map[Position][]Hint,
+	codeAnnotations map[Position][]Annotation,
+	opts CompareOptions,
+) (report Report) {
+	staleSeverity := SeverityWarning
+	if opts.Strict {
+		staleSeverity = SeverityError
+	}
+
+	report.Kinds = make(map[AnnotationKind]KindStats)
+
+	if opts.IgnorePathCase {
+		compilerHints = foldPathCase(compilerHints, codeAnnotations)
+	}
+
+	// The compiler flags are applied per package, so a package that was built
+	// with -m is expected to have hints in at least one of its files.
+	instrumented := make(map[string]bool)
+	for pos := range compilerHints {
+		instrumented[filepath.Dir(pos.File)] = true
+	}
+
+	// The names of the functions inlined anywhere, collected on first use.
+	var inlined map[string][]Hint
+
+	for pos, annotations := range codeAnnotations {
+		dir := filepath.Dir(pos.File)
+
+		// The packages left out on purpose are not worth a warning.
+		excluded := len(opts.Instrumented) > 0 && !inPackages(dir, opts.Instrumented)
+		uninstrumented := len(opts.Instrumented) == 0 && !instrumented[dir]
+
+		for _, ann := range annotations {
+			if !ann.AppliesTo(opts.GOARCH) {
+				continue
+			}
+
+			if len(opts.Enabled) > 0 && !slices.Contains(opts.Enabled, ann.Kind) {
+				continue
+			}
+
+			if excluded || uninstrumented {
+				if uninstrumented && !slices.Contains(report.Uninstrumented, dir) {
+					report.Uninstrumented = append(report.Uninstrumented, dir)
+				}
+
+				report.Skipped++
+
+				continue
+			}
+
+			spanStart := pos
+			if ann.StartLine > 0 {
+				spanStart.Line = ann.StartLine
+			}
+
+			hints := hintsInSpan(compilerHints, spanStart, ann.EndLine)
+			for _, site := range ann.Sites {
+				hints = append(hints, compilerHints[site]...)
+			}
+
+			// An inlining annotation on a function declaration is about the
+			// function itself rather than the calls at the line.
+			symbol := cmp.Or(ann.Symbol, ann.Func)
+
+			// The compiler reports inlining at the call sites, so a function
+			// named by an inlining annotation, or declared at its line, is
+			// inlined as long as any of its calls is.
+			if isInlining(ann) && symbol != "" {
+				if inlined == nil {
+					inlined = inlinedCalls(compilerHints)
+				}
+
+				hints = append(slices.Clip(hints), inlined[symbol]...)
+			}
+
+			report.Checked++
+			stats := report.Kinds[ann.Kind]
+			stats.Checked++
+
+			// A bounds check may be reported at a neighboring line after
+			// inlining, which the window accounts for.
+			nearby := ann.Kind == NoBoundsCheck && opts.BCEWindow > 0 &&
+				hasHintNearby(compilerHints, pos, opts.BCEWindow, FoundIsInBounds)
+
+			// An annotation without any hints usually means the code has been
+			// moved around, and the annotation no longer points where it should.
+			// A struct field only gets hints when its variables escape, so it
+			// is fine as long as its address is taken somewhere. The checks
+			// would only fail for the lack of hints, e.g. as a function that
+			// is not inlined, so they are skipped.
+			if len(hints) == 0 && len(ann.Sites) == 0 && !nearby {
+				report.Unmatched++
+				stats.Unmatched++
+				report.Findings = append(report.Findings, Finding{
+					Position:   pos,
+					Annotation: ann,
+					Severity:   staleSeverity,
+					Subject:    "annotation",
+					Message:    "matched no compiler output; is it stale?",
+					Stale:      true,
+					Column:     ann.Column,
+				})
+
+				stats.Stale++
+				report.Kinds[ann.Kind] = stats
+
+				continue
+			}
+
+			// A named annotation is only checked against the hints about its
+			// symbol, so that several values on one line are told apart.
+			// A function that is not inlined anywhere is reported below.
+			if symbol != "" && len(hints) > 0 {
+				hints = namedHints(hints, symbol)
+
+				if len(hints) == 0 && !isInlining(ann) {
+					report.Findings = append(report.Findings, Finding{
+						Position:   pos,
+						Annotation: ann,
+						Severity:   staleSeverity,
+						Subject:    "annotation",
+						Message:    fmt.Sprintf("matched no compiler output about %s", symbol),
+						Column:     ann.Column,
+					})
+
+					stats.Stale++
+					report.Kinds[ann.Kind] = stats
+
+					continue
+				}
+			}
+
+			checked := len(report.Findings)
+
+			if checker, ok := lookupChecker(ann.Kind); ok {
+				target := Target{
+					Position:   pos,
+					Annotation: ann,
+					Hints:      hints,
+					AllHints:   compilerHints,
+					Options:    opts,
+				}
+
+				report.Findings = append(report.Findings, checker.Check(target)...)
+			}
+
+			// An allowed annotation is known to fail, so it is only tracked.
+			if ann.Allow && len(report.Findings) > checked {
+				for i := checked; i < len(report.Findings); i++ {
+					report.Findings[i].Severity = SeverityWarning
+				}
+
+				report.Allowed++
+			}
+
+			switch {
+			case len(report.Findings) > checked && ann.Allow:
+				stats.Allowed++
+			case len(report.Findings) > checked:
+				stats.Failed++
+			default:
+				stats.Passed++
+			}
+
+			report.Kinds[ann.Kind] = stats
+		}
+	}
+
+	for _, typo := range opts.Typos {
+		report.Findings = append(report.Findings, typo.Finding())
+	}
+
+	slices.Sort(report.Uninstrumented)
+	report.Findings = sortFindings(report.Findings)
+	readSnippets(report.Findings)
+
+	return report
+}
+
+// inPackages tells whether the directory is one of the packages, or within one
+// ending with /....
+func inPackages(dir string, pkgs []string) bool {
+	for _, pkg := range pkgs {
+		if root, ok := strings.CutSuffix(pkg, string(filepath.Separator)+"..."); ok {
+			if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+				return true
+			}
+		} else if dir == pkg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// foldPathCase returns the compiler hints with the file paths spelled as in the
+// annotations wherever they only differ in case, so that the reported paths are
+// the ones of the source files.
+func foldPathCase(compilerHints map[Position][]Hint, codeAnnotations map[Position][]Annotation) map[Position][]Hint {
+	files := make(map[string]string)
+	for pos := range codeAnnotations {
+		files[strings.ToLower(pos.File)] = pos.File
+	}
+
+	folded := make(map[Position][]Hint, len(compilerHints))
+
+	for pos, hints := range compilerHints {
+		if file, ok := files[strings.ToLower(pos.File)]; ok {
+			pos.File = file
+		}
+
+		folded[pos] = append(folded[pos], hints...)
+	}
+
+	return folded
+}
+
+// sortFindings orders the findings by file, line and annotation, so that the
+// output is stable between runs, and removes the duplicates.
+func sortFindings(findings []Finding) []Finding {
+	compareFindings := func(a, b Finding) int {
+		return cmp.Or(
+			cmp.Compare(a.Position.File, b.Position.File),
+			cmp.Compare(a.Position.Line, b.Position.Line),
+			cmp.Compare(a.Annotation.String(), b.Annotation.String()),
+			cmp.Compare(a.Severity, b.Severity),
+			cmp.Compare(a.Subject, b.Subject),
+			cmp.Compare(a.Message, b.Message),
+		)
+	}
+
+	slices.SortFunc(findings, compareFindings)
+
+	return slices.CompactFunc(findings, func(a, b Finding) bool {
+		return compareFindings(a, b) == 0
+	})
+}
+
+// hintsInSpan returns the hints from the position up to the end line, or only
+// the ones at the position if the end line is before it.
+func hintsInSpan(compilerHints map[Position][]Hint, pos Position, endLine int) []Hint {
+	if endLine <= pos.Line {
+		return compilerHints[pos]
+	}
+
+	var hints []Hint
+	for line := pos.Line; line <= endLine; line++ {
+		hints = append(hints, compilerHints[Position{File: pos.File, Line: line}]...)
+	}
+
+	return hints
+}
+
+// namedHints returns the hints about the symbol. The hints are copied, since
+// they may share the backing array with the compiler hints.
+func namedHints(hints []Hint, symbol string) []Hint {
+	var named []Hint
+
+	for _, h := range hints {
+		if hintSymbol(h) == symbol {
+			named = append(named, h)
+		}
+	}
+
+	return named
+}
+
+// hintSymbol returns the symbol of the hint, without the type arguments of an
+// inlined generic function, as in "inlining call to add[go.shape.int]" or
+// "can inline (*List[go.shape.int]).Push".
+func hintSymbol(h Hint) string {
+	if (h.Kind != Inlined && h.Kind != CanInline && h.Kind != CannotInline) || !strings.Contains(h.Symbol, "[") {
+		return h.Symbol
+	}
+
+	var name strings.Builder
+
+	depth := 0
+	for _, r := range h.Symbol {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case depth == 0:
+			name.WriteRune(r)
+		}
+	}
+
+	return name.String()
+}
+
+// inlinedCalls groups the inlining hints by the name of the inlined function.
+// The functions that are too complex to be inlined are included, so that the
+// failure can tell their cost.
+func inlinedCalls(compilerHints map[Position][]Hint) map[string][]Hint {
+	calls := make(map[string][]Hint)
+
+	for _, hints := range compilerHints {
+		for _, h := range hints {
+			if (h.Kind == Inlined || h.Kind == CannotInline) && h.Symbol != "" {
+				calls[hintSymbol(h)] = append(calls[hintSymbol(h)], h)
+			}
+		}
+	}
+
+	return calls
+}
+
+// inlineCost describes the cost of a function that is too complex to be
+// inlined, as in " (cost 120 > budget 80)", if the compiler reported it.
+func inlineCost(hints []Hint) string {
+	i := slices.IndexFunc(hints, func(h Hint) bool { return h.Kind == CannotInline && h.Budget > 0 })
+	if i < 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (cost %d > budget %d)", hints[i].Cost, hints[i].Budget)
+}
+
+// isMakeHint reports whether the hint is about the result of a make call, such
+// as "make([]byte, 64) does not escape".
+func isMakeHint(h Hint) bool {
+	return strings.HasPrefix(h.Symbol, "make(")
+}
+
+func isHeapMake(h Hint) bool {
+	return isMakeHint(h) && (h.Kind == EscapesToHeap || h.Kind == MovedToHeap)
+}
+
+func isStackMake(h Hint) bool {
+	return isMakeHint(h) && (h.Kind == DoesNotEscape || h.Kind == StaysOnStack)
+}
+
+// hasHintNearby reports whether the hint is present within the given number of
+// lines around the position.
+func hasHintNearby(compilerHints map[Position][]Hint, pos Position, window int, hint CompilerHint) bool {
+	for line := pos.Line - window; line <= pos.Line+window; line++ {
+		if hasHint(compilerHints[Position{File: pos.File, Line: line}], hint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const maxSnippetLength = 120
+
+// readSnippets fills in the source line of every finding, so that the output
+// can be understood without opening the file. Each file is read at most once.
+func readSnippets(findings []Finding) {
+	files := make(map[string][]string)
+
+	for i := range findings {
+		pos := findings[i].Position
+
+		lines, ok := files[pos.File]
+		if !ok {
+			if data, err := os.ReadFile(pos.File); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+
+			files[pos.File] = lines
+		}
+
+		if pos.Line < 1 || pos.Line > len(lines) {
+			continue
+		}
+
+		snippet := []rune(strings.TrimSpace(lines[pos.Line-1]))
+		if len(snippet) > maxSnippetLength {
+			snippet = append(snippet[:maxSnippetLength-3], []rune("...")...)
+		}
+
+		findings[i].Snippet = string(snippet)
+	}
+}
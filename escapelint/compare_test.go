@@ -0,0 +1,1436 @@
+package escapelint
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// kindHints converts the hint kinds to hints without symbols.
+func kindHints(kinds map[Position][]CompilerHint) map[Position][]Hint {
+	hints := make(map[Position][]Hint, len(kinds))
+
+	for pos, posKinds := range kinds {
+		for _, kind := range posKinds {
+			hints[pos] = append(hints[pos], Hint{Kind: kind})
+		}
+	}
+
+	return hints
+}
+
+// absPath joins the path elements into an absolute path, like the ones in the
+// positions produced by the parsers.
+func absPath(t testing.TB, elem ...string) string {
+	t.Helper()
+
+	p, err := filepath.Abs(filepath.Join(elem...))
+	if err != nil {
+		t.Fatalf("failed to resolve %s: %v", filepath.Join(elem...), err)
+	}
+
+	return p
+}
+
+func TestCompareResults(t *testing.T) {
+	tests := []struct {
+		name            string
+		compilerHints   map[Position][]CompilerHint
+		codeAnnotations map[Position][]Annotation
+		expectedValid   bool
+	}{
+		{
+			name: "validCases",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {StaysOnStack},
+				{File: "main.go", Line: 15}: {StaysOnStack},
+				{File: "main.go", Line: 25}: {Inlined},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 15}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 20}: {{Kind: NoBoundsCheck}},
+				{File: "main.go", Line: 25}: {{Kind: MustInline}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "validDoesNotEscape",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {DoesNotEscape},
+				{File: "main.go", Line: 15}: {DoesNotEscape, StaysOnStack},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 15}: {{Kind: NoEscape}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "invalidNoEscape",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {EscapesToHeap},
+				{File: "main.go", Line: 15}: {MovedToHeap},
+				{File: "main.go", Line: 20}: {StaysOnStack},
+				{File: "main.go", Line: 25}: {Inlined},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 15}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 20}: {{Kind: NoBoundsCheck}},
+				{File: "main.go", Line: 25}: {{Kind: MustInline}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "invalidNoBoundsCheck",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {StaysOnStack},
+				{File: "main.go", Line: 15}: {StaysOnStack},
+				{File: "main.go", Line: 20}: {FoundIsInBounds},
+				{File: "main.go", Line: 25}: {Inlined},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 15}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 20}: {{Kind: NoBoundsCheck}},
+				{File: "main.go", Line: 25}: {{Kind: MustInline}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "validNoInline",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {StaysOnStack},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoInline}},
+				{File: "main.go", Line: 15}: {{Kind: NoInline}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "invalidNoInline",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {StaysOnStack},
+				{File: "main.go", Line: 25}: {Inlined},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoInline}},
+				{File: "main.go", Line: 25}: {{Kind: NoInline}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "invalidMustInline",
+			compilerHints: map[Position][]CompilerHint{
+				{File: "main.go", Line: 10}: {StaysOnStack},
+				{File: "main.go", Line: 15}: {StaysOnStack},
+				{File: "main.go", Line: 20}: {StaysOnStack},
+				{File: "main.go", Line: 25}: {StaysOnStack},
+			},
+			codeAnnotations: map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 15}: {{Kind: NoEscape}},
+				{File: "main.go", Line: 20}: {{Kind: NoBoundsCheck}},
+				{File: "main.go", Line: 25}: {{Kind: MustInline}},
+			},
+			expectedValid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := CompareResults(kindHints(tt.compilerHints), tt.codeAnnotations, CompareOptions{}).Valid()
+			if valid != tt.expectedValid {
+				t.Fatalf("expected %v, got %v", tt.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestCompareResultsCounts(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}:  {EscapesToHeap},
+		{File: "other.go", Line: 15}: {FoundIsInBounds},
+		{File: "other.go", Line: 25}: {StaysOnStack},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}:  {{Kind: NoEscape}},
+		{File: "other.go", Line: 15}: {{Kind: NoBoundsCheck}},
+		{File: "other.go", Line: 20}: {{Kind: MustInline}},
+		{File: "other.go", Line: 25}: {{Kind: NoEscape}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+	// The stale annotation is not reported as failing on top of that.
+	if len(report.Findings) != 3 {
+		t.Errorf("expected 3 findings, got %d", len(report.Findings))
+	}
+
+	if report.Errors() != 2 {
+		t.Errorf("expected 2 errors, got %d", report.Errors())
+	}
+
+	if report.Checked != 4 {
+		t.Errorf("expected 4 checked annotations, got %d", report.Checked)
+	}
+
+	if report.Unmatched != 1 {
+		t.Errorf("expected 1 unmatched annotation, got %d", report.Unmatched)
+	}
+
+	expectedKinds := map[AnnotationKind]KindStats{
+		NoEscape:      {Checked: 2, Passed: 1, Failed: 1},
+		NoBoundsCheck: {Checked: 1, Failed: 1},
+		MustInline:    {Checked: 1, Unmatched: 1, Stale: 1},
+	}
+
+	if !maps.Equal(report.Kinds, expectedKinds) {
+		t.Errorf("expected %v, got %v", expectedKinds, report.Kinds)
+	}
+
+	expectedSummary := "2 failures across 2 files (4 annotations checked, 1 matched no compiler hints)"
+	if summary := report.Summary(); summary != expectedSummary {
+		t.Errorf("expected summary %q, got %q", expectedSummary, summary)
+	}
+}
+
+func TestCompareResultsVerdicts(t *testing.T) {
+	compilerHints := map[Position][]Hint{
+		{File: "main.go", Line: 10}: {{Kind: EscapesToHeap, Symbol: "a"}},
+		{File: "main.go", Line: 11}: {{Kind: EscapesToHeap, Symbol: "b"}},
+		{File: "main.go", Line: 12}: {{Kind: DoesNotEscape, Symbol: "c"}},
+		{File: "main.go", Line: 14}: {{Kind: Inlined, Symbol: "add"}},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+		{File: "main.go", Line: 11}: {{Kind: NoEscape, Allow: true}},
+		{File: "main.go", Line: 12}: {{Kind: NoEscape, Symbol: "d"}, {Kind: NoEscape, Symbol: "c"}},
+		{File: "main.go", Line: 13}: {{Kind: NoEscape}},
+		{File: "main.go", Line: 14}: {{Kind: MustInline}, {Kind: NoInline}},
+	}
+
+	report := CompareResults(compilerHints, codeAnnotations, CompareOptions{})
+
+	expectedKinds := map[AnnotationKind]KindStats{
+		NoEscape:   {Checked: 5, Unmatched: 1, Passed: 1, Failed: 1, Allowed: 1, Stale: 2},
+		MustInline: {Checked: 1, Passed: 1},
+		NoInline:   {Checked: 1, Failed: 1},
+	}
+
+	if !maps.Equal(report.Kinds, expectedKinds) {
+		t.Errorf("expected %+v, got %+v", expectedKinds, report.Kinds)
+	}
+}
+
+func TestCompareResultsIgnorePathCase(t *testing.T) {
+	// The compiler spells the file as it was given on the command line, while
+	// the walk yields the name stored on disk.
+	compilerHints := map[Position][]CompilerHint{
+		{File: "/src/pkg/Main.go", Line: 10}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "/src/pkg/main.go", Line: 10}: {{Kind: NoEscape}},
+	}
+
+	tests := []struct {
+		name           string
+		ignorePathCase bool
+		expected       string
+	}{
+		{name: "case-sensitive", ignorePathCase: false, expected: "matched no compiler output; is it stale?"},
+		{name: "case-insensitive", ignorePathCase: true, expected: "is marked as no-escape but escapes to heap"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{IgnorePathCase: tt.ignorePathCase})
+
+			if len(report.Findings) != 1 || report.Findings[0].Message != tt.expected {
+				t.Fatalf("expected a finding that %s, got %v", tt.expected, report.Findings)
+			}
+
+			// The paths of the source files are kept for the report.
+			if file := report.Findings[0].Position.File; file != "/src/pkg/main.go" {
+				t.Errorf("expected the path of the source file, got %s", file)
+			}
+		})
+	}
+}
+
+func TestCompareResultsStale(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {StaysOnStack},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+		{File: "main.go", Line: 11}: {{Kind: NoEscape}},
+	}
+
+	tests := []struct {
+		name             string
+		opts             CompareOptions
+		expectedSeverity Severity
+		expectedValid    bool
+	}{
+		{
+			name:             "default",
+			opts:             CompareOptions{},
+			expectedSeverity: SeverityWarning,
+			expectedValid:    true,
+		},
+		{
+			name:             "strict",
+			opts:             CompareOptions{Strict: true},
+			expectedSeverity: SeverityError,
+			expectedValid:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := CompareResults(kindHints(compilerHints), codeAnnotations, tt.opts)
+
+			if len(report.Findings) != 1 {
+				t.Fatalf("expected 1 finding, got %d", len(report.Findings))
+			}
+
+			finding := report.Findings[0]
+			expectedPos := Position{File: "main.go", Line: 11}
+
+			if finding.Position != expectedPos {
+				t.Errorf("expected finding at %v, got %v", expectedPos, finding.Position)
+			}
+
+			if finding.Severity != tt.expectedSeverity {
+				t.Errorf("expected severity %s, got %s", tt.expectedSeverity, finding.Severity)
+			}
+
+			if report.Valid() != tt.expectedValid {
+				t.Errorf("expected valid=%v, got %v", tt.expectedValid, report.Valid())
+			}
+		})
+	}
+}
+
+func TestCompareResultsFuncScope(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {DoesNotEscape},
+		{File: "main.go", Line: 11}: {MovedToHeap},
+		{File: "main.go", Line: 12}: {DoesNotEscape},
+		{File: "main.go", Line: 13}: {EscapesToHeap},
+		{File: "main.go", Line: 16}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscapeFunc, EndLine: 15}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+	var lines []int
+	for _, finding := range report.Findings {
+		lines = append(lines, finding.Position.Line)
+	}
+
+	slices.Sort(lines)
+
+	if expected := []int{11, 13}; !slices.Equal(lines, expected) {
+		t.Errorf("expected findings at lines %v, got %v", expected, lines)
+	}
+
+	if report.Checked != 1 {
+		t.Errorf("expected 1 checked annotation, got %d", report.Checked)
+	}
+}
+
+func TestCompareResultsRegion(t *testing.T) {
+	hints, err := ParseCompilerOutput("testdata/region/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/region", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{Strict: true})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The variables escaping before and after the region are not reported.
+	expected := []string{
+		fmt.Sprintf("variable at %s:16 is in a region marked as no-escape-begin (hot loop) but escapes to heap",
+			absPath(t, "testdata", "region", "main.go")),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsStackAlloc(t *testing.T) {
+	hints, err := ParseCompilerOutput("testdata/stackalloc/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/stackalloc", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{Strict: true})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The buffer of a constant size stays on stack, while the one sized at run
+	// time is allocated on the heap.
+	expected := []string{
+		fmt.Sprintf("allocation at %s:10 is marked as stack-alloc but make([]byte, n) escapes to heap",
+			absPath(t, "testdata", "stackalloc", "main.go")),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+
+	// A line without any make call has no evidence of a stack allocation.
+	pos := Position{File: "main.go", Line: 1}
+	report = CompareResults(
+		map[Position][]Hint{pos: {{Kind: DoesNotEscape, Symbol: "p"}}},
+		map[Position][]Annotation{pos: {{Kind: StackAlloc}}},
+		CompareOptions{},
+	)
+
+	if len(report.Findings) != 1 || report.Findings[0].Message != "is marked as stack-alloc but no make is reported to stay on stack" {
+		t.Errorf("expected a finding about the missing make, got %v", report.Findings)
+	}
+}
+
+func TestParsersPositionsIntersect(t *testing.T) {
+	// The compiler output is found relative to the working directory, while
+	// the package is given as an absolute path, so the same files are spelled
+	// differently on both sides.
+	hints, err := ParseCompilerOutput(filepath.Join("testdata", "example", "build.log"))
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations(absPath(t, "testdata", "example"), DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	matched := 0
+	for pos := range annotations {
+		if _, ok := hints[pos]; ok {
+			matched++
+		}
+	}
+
+	if matched != len(annotations) {
+		t.Errorf("expected all %d annotated positions to have hints, got %d", len(annotations), matched)
+	}
+}
+
+func TestCompareResultsOrder(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "b.go", Line: 5}:  {EscapesToHeap, EscapesToHeap},
+		{File: "a.go", Line: 20}: {MovedToHeap},
+		{File: "a.go", Line: 3}:  {FoundIsInBounds},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "b.go", Line: 5}:  {{Kind: NoEscape}, {Kind: NoEscape}, {Kind: MustInline}},
+		{File: "a.go", Line: 20}: {{Kind: NoHeapMove}},
+		{File: "a.go", Line: 3}:  {{Kind: NoBoundsCheck}},
+		{File: "a.go", Line: 10}: {{Kind: NoEscape}},
+	}
+
+	expected := []string{
+		"variable at a.go:3 is marked as no-bounds-check but bounds check is not eliminated",
+		"annotation at a.go:10 matched no compiler output; is it stale?",
+		"variable at a.go:20 is marked as no-heap-move but is moved to heap",
+		"function at b.go:5 is marked as must-inline but is not inlined",
+		"variable at b.go:5 is marked as no-escape but escapes to heap",
+	}
+
+	for i := 0; i < 10; i++ {
+		report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+		var messages []string
+		for _, finding := range report.Findings {
+			messages = append(messages, finding.String())
+		}
+
+		if !slices.Equal(messages, expected) {
+			t.Fatalf("expected %q, got %q", expected, messages)
+		}
+	}
+}
+
+func TestCompareResultsNoAlloc(t *testing.T) {
+	compilerHints := map[Position][]Hint{
+		{File: "main.go", Line: 10}: {{Kind: DoesNotEscape, Symbol: "dst"}},
+		{File: "main.go", Line: 12}: {{Kind: EscapesToHeap, Symbol: "make([]byte, n)"}, {Kind: EscapesToHeap, Symbol: "&header{}"}},
+		{File: "main.go", Line: 13}: {{Kind: EscapesToHeap, Symbol: `"done"`}, {Kind: EscapesToHeap, Symbol: "42"}},
+		{File: "main.go", Line: 14}: {{Kind: MovedToHeap, Symbol: "buf"}},
+		{File: "main.go", Line: 20}: {{Kind: DoesNotEscape, Symbol: "b"}},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoAlloc, EndLine: 15}},
+		{File: "main.go", Line: 20}: {{Kind: NoAlloc, EndLine: 22}},
+	}
+
+	report := CompareResults(compilerHints, codeAnnotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// Every allocation is reported on its own, even on the same line.
+	expected := []string{
+		"heap allocation of &header{} at main.go:12 is in a function marked as no-alloc",
+		"heap allocation of make([]byte, n) at main.go:12 is in a function marked as no-alloc",
+		`heap allocation of "done" at main.go:13 is in a function marked as no-alloc`,
+		"heap allocation of 42 at main.go:13 is in a function marked as no-alloc",
+		"heap allocation of buf at main.go:14 is in a function marked as no-alloc",
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+
+	if stats := report.Kinds[NoAlloc]; stats.Passed != 1 || stats.Failed != 1 {
+		t.Errorf("expected 1 passed and 1 failed, got %+v", stats)
+	}
+}
+
+func TestCompareResultsUninstrumented(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: filepath.Join("hot", "main.go"), Line: 10}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: filepath.Join("hot", "main.go"), Line: 10}:  {{Kind: NoEscape}},
+		{File: filepath.Join("hot", "other.go"), Line: 5}:  {{Kind: MustInline}},
+		{File: filepath.Join("cold", "main.go"), Line: 10}: {{Kind: MustInline}},
+		{File: filepath.Join("cold", "util.go"), Line: 20}: {{Kind: NoEscape}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+	if expected := []string{"cold"}; !slices.Equal(report.Uninstrumented, expected) {
+		t.Errorf("expected uninstrumented packages %v, got %v", expected, report.Uninstrumented)
+	}
+
+	if report.Checked != 2 || report.Skipped != 2 {
+		t.Errorf("expected 2 checked and 2 skipped annotations, got %d and %d", report.Checked, report.Skipped)
+	}
+
+	for _, finding := range report.Findings {
+		if strings.HasPrefix(finding.Position.File, "cold") {
+			t.Errorf("unexpected finding in an uninstrumented package: %s", finding)
+		}
+	}
+
+	if summary := report.Summary(); !strings.HasSuffix(summary, ", 2 skipped)") {
+		t.Errorf("expected the skipped annotations in the summary, got %q", summary)
+	}
+}
+
+func TestCompareResultsInstrumented(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: filepath.Join("hot", "main.go"), Line: 10}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: filepath.Join("hot", "main.go"), Line: 10}:         {{Kind: NoEscape}},
+		{File: filepath.Join("hot", "inner", "main.go"), Line: 5}: {{Kind: MustInline}},
+		{File: filepath.Join("warm", "main.go"), Line: 10}:        {{Kind: NoEscape}},
+		{File: filepath.Join("cold", "main.go"), Line: 10}:        {{Kind: MustInline}},
+	}
+
+	// The packages given explicitly are checked even without any hints, and
+	// the others are skipped without being reported as uninstrumented.
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{
+		Instrumented: []string{filepath.Join("hot", "..."), "warm"},
+	})
+
+	if len(report.Uninstrumented) != 0 {
+		t.Errorf("expected no uninstrumented packages, got %v", report.Uninstrumented)
+	}
+
+	if report.Checked != 3 || report.Skipped != 1 {
+		t.Errorf("expected 3 checked and 1 skipped annotations, got %d and %d", report.Checked, report.Skipped)
+	}
+
+	var stale []string
+	for _, finding := range report.Findings {
+		if finding.Stale {
+			stale = append(stale, finding.Position.File)
+		}
+	}
+
+	expected := []string{filepath.Join("hot", "inner", "main.go"), filepath.Join("warm", "main.go")}
+	if !slices.Equal(stale, expected) {
+		t.Errorf("expected stale annotations in %v, got %v", expected, stale)
+	}
+}
+
+func TestCompareResultsStructFields(t *testing.T) {
+	hints, err := ParseCompilerOutput("testdata/fields/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/fields", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	mainGo := absPath(t, "testdata", "fields", "main.go")
+
+	expectedSites := map[int][]Position{
+		6: {{File: mainGo, Line: 12}},
+		7: {{File: mainGo, Line: 18}},
+	}
+
+	for line, sites := range expectedSites {
+		if anns := annotations[Position{File: mainGo, Line: line}]; len(anns) != 1 || !slices.Equal(anns[0].Sites, sites) {
+			t.Errorf("expected sites %v at line %d, got %v", sites, line, anns)
+		}
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{Strict: true})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	expected := []string{
+		fmt.Sprintf("variable at %s:6 is marked as no-escape but escapes to heap", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsNamedAnnotations(t *testing.T) {
+	compilerHints := map[Position][]Hint{
+		{File: "main.go", Line: 10}: {
+			{Kind: MovedToHeap, Symbol: "buf"},
+			{Kind: DoesNotEscape, Symbol: "tmp"},
+		},
+		{File: "main.go", Line: 20}: {
+			{Kind: Inlined, Symbol: "add"},
+		},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape, Symbol: "buf"}, {Kind: NoEscape, Symbol: "tmp"}},
+		{File: "main.go", Line: 20}: {{Kind: MustInline, Symbol: "add"}, {Kind: MustInline, Symbol: "sub"}},
+	}
+
+	report := CompareResults(compilerHints, codeAnnotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	expected := []string{
+		"variable at main.go:10 is marked as no-escape:buf but escapes to heap",
+		"function at main.go:20 is marked as must-inline:sub but is not inlined",
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsNamedAddressOf(t *testing.T) {
+	// Produced with: go build -gcflags=-m 2> build.log
+	hints, err := ParseCompilerOutput("testdata/addressof/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/addressof", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	var messages []string
+	for _, finding := range CompareResults(hints, annotations, CompareOptions{}).Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The compiler reports the variables moved to heap at their declarations
+	// rather than the lines taking their addresses.
+	mainGo := absPath(t, "testdata", "addressof", "main.go")
+	expected := []string{
+		fmt.Sprintf("variable at %s:8 is marked as no-escape:x but escapes to heap", mainGo),
+		fmt.Sprintf("variable at %s:13 is marked as no-escape:buf but escapes to heap", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsNamedAddressOfLegacy(t *testing.T) {
+	// Written by hand in the format of Go 1.12 and earlier, which reported the
+	// address-of expressions escaping along with the variables moved to heap.
+	hints, err := ParseCompilerOutput("testdata/addressof_legacy/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/addressof_legacy", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	var messages []string
+	for _, finding := range CompareResults(hints, annotations, CompareOptions{}).Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The escaping address is about the variable named by the annotation,
+	// rather than a symbol of its own.
+	mainGo := absPath(t, "testdata", "addressof_legacy", "main.go")
+	expected := []string{
+		fmt.Sprintf("variable at %s:9 is marked as no-escape:x but escapes to heap", mainGo),
+		fmt.Sprintf("variable at %s:14 is marked as no-escape:buf but escapes to heap", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsExpect(t *testing.T) {
+	compilerHints := map[Position][]Hint{
+		{File: "main.go", Line: 10}: {{Kind: StaysOnStack, Symbol: "make([]byte, 64)"}},
+		{File: "main.go", Line: 20}: {{Kind: MovedToHeap, Symbol: "x"}},
+		{File: "main.go", Line: 30}: {{Kind: Inlined, Symbol: "add"}},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: Expect, Hint: StaysOnStack}},
+		{File: "main.go", Line: 20}: {{Kind: Expect, Hint: StaysOnStack}},
+		{File: "main.go", Line: 30}: {{Kind: Expect, Hint: Inlined, Symbol: "add"}, {Kind: Expect, Hint: CanInline, Symbol: "add"}},
+	}
+
+	var messages []string
+	for _, finding := range CompareResults(compilerHints, codeAnnotations, CompareOptions{}).Findings {
+		messages = append(messages, finding.String())
+	}
+
+	expected := []string{
+		"line at main.go:20 is marked as expect:stays-on-stack but the compiler reports no stays-on-stack",
+		"line at main.go:30 is marked as expect:can-inline:add but the compiler reports no can-inline",
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsMustInlineByName(t *testing.T) {
+	// The functions are declared at lines 3 to 5, and called at lines 10 to 12.
+	compilerHints := map[Position][]Hint{
+		{File: "main.go", Line: 10}: {{Kind: Inlined, Symbol: "add"}},
+		{File: "main.go", Line: 11}: {{Kind: Inlined, Symbol: "max[go.shape.int]"}},
+		{File: "main.go", Line: 12}: {{Kind: EscapesToHeap, Symbol: "sub(1, 2)"}},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 3}: {{Kind: MustInline, Symbol: "add"}},
+		{File: "main.go", Line: 4}: {{Kind: MustInline, Symbol: "max"}},
+		{File: "main.go", Line: 5}: {{Kind: MustInline, Symbol: "sub"}},
+	}
+
+	report := CompareResults(compilerHints, codeAnnotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	expected := []string{
+		"annotation at main.go:5 matched no compiler output; is it stale?",
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsMustInlineDeclaration(t *testing.T) {
+	annotations, _, err := ParseCodeAnnotations("testdata/inline", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	mainGo := absPath(t, "testdata", "inline", "main.go")
+
+	for _, line := range []int{5, 9, 11, 29, 31} {
+		pos := Position{File: mainGo, Line: line}
+		if len(annotations[pos]) != 1 || annotations[pos][0].Func == "" {
+			t.Errorf("expected an inlining annotation resolved to a function at %v, got %v", pos, annotations[pos])
+		}
+	}
+
+	// Both inc and add are inlined at each of their call sites, while sum
+	// has a defer statement and is never inlined. The unused functions can be
+	// inlined, which is enough for must-inline but not for always-inlined.
+	expected := []string{
+		fmt.Sprintf("function at %s:11 is marked as must-inline but is not inlined", mainGo),
+		fmt.Sprintf("function at %s:31 is marked as always-inlined but is not inlined at any call site", mainGo),
+	}
+
+	// The "can inline" messages are printed with the cost at -m=2.
+	for _, log := range []string{"build.log", "build-m2.log"} {
+		t.Run(log, func(t *testing.T) {
+			hints, err := ParseCompilerOutput(filepath.Join("testdata", "inline", log))
+			if err != nil {
+				t.Fatalf("ParseCompilerOutput failed: %v", err)
+			}
+
+			report := CompareResults(hints, annotations, CompareOptions{})
+
+			var messages []string
+			for _, finding := range report.Findings {
+				messages = append(messages, finding.String())
+			}
+
+			if !slices.Equal(messages, expected) {
+				t.Errorf("expected %q, got %q", expected, messages)
+			}
+		})
+	}
+}
+
+func TestCompareResultsAllow(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {MovedToHeap},
+		{File: "main.go", Line: 20}: {DoesNotEscape},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape, Allow: true}},
+		{File: "main.go", Line: 20}: {{Kind: NoEscape, Allow: true}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+	// The escape is known, so it is tracked as a warning that does not fail
+	// the check, while the satisfied annotation is not counted.
+	if len(report.Findings) != 1 || report.Findings[0].Severity != SeverityWarning {
+		t.Fatalf("expected a single warning, got %v", report.Findings)
+	}
+
+	if !report.Valid() {
+		t.Errorf("expected the report to be valid")
+	}
+
+	if report.Allowed != 1 {
+		t.Errorf("expected 1 allowed annotation, got %d", report.Allowed)
+	}
+
+	expectedSummary := "0 failures across 0 files (2 annotations checked, 0 matched no compiler hints, 1 allowed)"
+	if summary := report.Summary(); summary != expectedSummary {
+		t.Errorf("expected summary %q, got %q", expectedSummary, summary)
+	}
+}
+
+func TestCompareResultsEnabled(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {MovedToHeap},
+		{File: "main.go", Line: 20}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape}},
+		{File: "main.go", Line: 20}: {{Kind: MustInline}},
+		{File: "main.go", Line: 30}: {{Kind: NoBoundsCheck}},
+	}
+
+	tests := map[string]struct {
+		enabled  []AnnotationKind
+		expected []string
+		checked  int
+	}{
+		"all": {
+			expected: []string{
+				"variable at main.go:10 is marked as no-escape but escapes to heap",
+				"function at main.go:20 is marked as must-inline but is not inlined",
+				"annotation at main.go:30 matched no compiler output; is it stale?",
+			},
+			checked: 3,
+		},
+		"must-inline only": {
+			enabled:  []AnnotationKind{MustInline},
+			expected: []string{"function at main.go:20 is marked as must-inline but is not inlined"},
+			checked:  1,
+		},
+		"no-escape and no-bounds-check": {
+			enabled: []AnnotationKind{NoEscape, NoBoundsCheck},
+			expected: []string{
+				"variable at main.go:10 is marked as no-escape but escapes to heap",
+				"annotation at main.go:30 matched no compiler output; is it stale?",
+			},
+			checked: 2,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{Enabled: tt.enabled})
+
+			var messages []string
+			for _, finding := range report.Findings {
+				messages = append(messages, finding.String())
+			}
+
+			if !slices.Equal(messages, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, messages)
+			}
+
+			if report.Checked != tt.checked {
+				t.Errorf("expected %d annotations checked, got %d", tt.checked, report.Checked)
+			}
+		})
+	}
+}
+
+func TestCompareResultsReason(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape, Reason: "hot path"}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+	if len(report.Findings) != 1 {
+		t.Fatalf("expected 1 finding, got %d", len(report.Findings))
+	}
+
+	expected := "variable at main.go:10 is marked as no-escape (hot path) but escapes to heap"
+	if msg := report.Findings[0].String(); msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+}
+
+func TestCompareResultsSnippet(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := "package main\n\nfunc main() {\n\tbuf := make([]byte, n) //no-escape\n\tx := \"" + strings.Repeat("x", 200) + "\" //no-escape\n}\n"
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	compilerHints := map[Position][]CompilerHint{
+		{File: mainGoFile, Line: 4}: {EscapesToHeap},
+		{File: mainGoFile, Line: 5}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: mainGoFile, Line: 4}: {{Kind: NoEscape}},
+		{File: mainGoFile, Line: 5}: {{Kind: NoEscape}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+	if len(report.Findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(report.Findings))
+	}
+
+	for _, finding := range report.Findings {
+		switch finding.Position.Line {
+		case 4:
+			if expected := "buf := make([]byte, n) //no-escape"; finding.Snippet != expected {
+				t.Errorf("expected snippet %q, got %q", expected, finding.Snippet)
+			}
+		case 5:
+			if len(finding.Snippet) != maxSnippetLength || !strings.HasSuffix(finding.Snippet, "...") {
+				t.Errorf("expected snippet to be truncated, got %q", finding.Snippet)
+			}
+		}
+	}
+}
+
+func TestCompareResultsArches(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {FoundIsInBounds},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoBoundsCheck, Arches: []string{"amd64"}}},
+	}
+
+	tests := []struct {
+		goarch          string
+		expectedValid   bool
+		expectedChecked int
+	}{
+		{goarch: "amd64", expectedValid: false, expectedChecked: 1},
+		{goarch: "arm64", expectedValid: true, expectedChecked: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goarch, func(t *testing.T) {
+			report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{GOARCH: tt.goarch})
+
+			if report.Valid() != tt.expectedValid {
+				t.Errorf("expected valid=%v, got %v", tt.expectedValid, report.Valid())
+			}
+
+			if report.Checked != tt.expectedChecked {
+				t.Errorf("expected %d checked annotations, got %d", tt.expectedChecked, report.Checked)
+			}
+		})
+	}
+}
+
+func TestCompareResultsBCEWindow(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {Inlined},
+		{File: "main.go", Line: 12}: {FoundIsInBounds},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoBoundsCheck}},
+	}
+
+	tests := []struct {
+		window        int
+		expectedValid bool
+	}{
+		{window: 0, expectedValid: true},
+		{window: 1, expectedValid: true},
+		{window: 2, expectedValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("window=%d", tt.window), func(t *testing.T) {
+			report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{BCEWindow: tt.window})
+			if report.Valid() != tt.expectedValid {
+				t.Errorf("expected valid=%v, got %v", tt.expectedValid, report.Valid())
+			}
+		})
+	}
+
+	// A line without hints of its own is not stale if a bounds check is
+	// found within the window, which is the only finding.
+	report := CompareResults(kindHints(compilerHints), map[Position][]Annotation{
+		{File: "main.go", Line: 11}: {{Kind: NoBoundsCheck}},
+	}, CompareOptions{BCEWindow: 1})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	expected := []string{"variable at main.go:11 is marked as no-bounds-check but bounds check is not eliminated"}
+	if !slices.Equal(messages, expected) || report.Unmatched != 0 {
+		t.Errorf("expected %q and no unmatched annotations, got %q and %d", expected, messages, report.Unmatched)
+	}
+}
+
+func TestCompareResultsHeapMoveAndEscape(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {MovedToHeap},
+		{File: "main.go", Line: 15}: {EscapesToHeap},
+	}
+
+	tests := []struct {
+		name          string
+		kind          AnnotationKind
+		expectedLines []int
+	}{
+		{name: "noEscape", kind: NoEscape, expectedLines: []int{10, 15}},
+		{name: "noHeapMove", kind: NoHeapMove, expectedLines: []int{10}},
+		{name: "noHeapEscape", kind: NoHeapEscape, expectedLines: []int{15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codeAnnotations := map[Position][]Annotation{
+				{File: "main.go", Line: 10}: {{Kind: tt.kind}},
+				{File: "main.go", Line: 15}: {{Kind: tt.kind}},
+			}
+
+			report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+			var lines []int
+			for _, finding := range report.Findings {
+				lines = append(lines, finding.Position.Line)
+			}
+
+			slices.Sort(lines)
+
+			if !slices.Equal(lines, tt.expectedLines) {
+				t.Errorf("expected findings at %v, got %v", tt.expectedLines, lines)
+			}
+		})
+	}
+}
+
+func TestCompareResultsMustInlineCost(t *testing.T) {
+	// Produced with: go build -gcflags=-m=2 2> build.log
+	hints, err := ParseCompilerOutput("testdata/inlinecost/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/inlinecost", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The cost is reported at the declaration, and found by the name of the
+	// function for the call site.
+	mainGo := absPath(t, "testdata", "inlinecost", "main.go")
+	expected := []string{
+		fmt.Sprintf("function at %s:3 is marked as must-inline but is not inlined (cost 100 > budget 80)", mainGo),
+		fmt.Sprintf("function at %s:23 is marked as must-inline:checksum but is not inlined (cost 100 > budget 80)", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsLevels(t *testing.T) {
+	annotations, _, err := ParseCodeAnnotations("testdata/levels", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	var reports [][]string
+
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	// and with -m=2 instead of -m to build-m2.log.
+	for _, log := range []string{"build.log", "build-m2.log"} {
+		hints, err := ParseCompilerOutput(filepath.Join("testdata", "levels", log))
+		if err != nil {
+			t.Fatalf("ParseCompilerOutput failed: %v", err)
+		}
+
+		var messages []string
+		for _, finding := range CompareResults(hints, annotations, CompareOptions{}).Findings {
+			messages = append(messages, finding.String())
+		}
+
+		reports = append(reports, messages)
+	}
+
+	// The explanations at -m=2 do not change the verdicts, e.g. the variable
+	// moved to heap is not reported as escaping to heap as well.
+	mainGo := absPath(t, "testdata", "levels", "main.go")
+	expected := []string{
+		fmt.Sprintf("variable at %s:16 is marked as no-escape:p but escapes to heap", mainGo),
+	}
+
+	for i, messages := range reports {
+		if !slices.Equal(messages, expected) {
+			t.Errorf("expected %q at level %d, got %q", expected, i+1, messages)
+		}
+	}
+}
+
+func TestCompareResultsStatementSpan(t *testing.T) {
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	hints, err := ParseCompilerOutput("testdata/statement/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	mainGo := absPath(t, "testdata", "statement", "main.go")
+
+	tests := []struct {
+		name          string
+		statementSpan bool
+		expected      []string
+	}{
+		{
+			name:          "exactLine",
+			statementSpan: false,
+			expected: []string{
+				fmt.Sprintf("annotation at %s:15 matched no compiler output; is it stale?", mainGo),
+				fmt.Sprintf("annotation at %s:26 matched no compiler output; is it stale?", mainGo),
+			},
+		},
+		{
+			// The escape of the composite literal is reported at its first
+			// line, while the lines in the body of the function literal
+			// are not part of the statement declaring it.
+			name:          "statementSpan",
+			statementSpan: true,
+			expected: []string{
+				fmt.Sprintf("variable at %s:15 is marked as no-escape but escapes to heap", mainGo),
+				fmt.Sprintf("annotation at %s:26 matched no compiler output; is it stale?", mainGo),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.StatementSpan = tt.statementSpan
+
+			annotations, _, err := ParseCodeAnnotations("testdata/statement", opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			var messages []string
+			for _, finding := range CompareResults(hints, annotations, CompareOptions{}).Findings {
+				messages = append(messages, finding.String())
+			}
+
+			if !slices.Equal(messages, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, messages)
+			}
+		})
+	}
+}
+
+func TestCompareResultsChainedCalls(t *testing.T) {
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	hints, err := ParseCompilerOutput("testdata/chain/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/chain", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	var messages []string
+	for _, finding := range CompareResults(hints, annotations, CompareOptions{}).Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The escape of the receiver is reported at the first line of the chain,
+	// be it in a variable declaration, an assignment or the header of a loop.
+	mainGo := absPath(t, "testdata", "chain", "main.go")
+	expected := []string{
+		fmt.Sprintf("variable at %s:17 is marked as no-escape but escapes to heap", mainGo),
+		fmt.Sprintf("variable at %s:22 is marked as no-escape but escapes to heap", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsIncludeTests(t *testing.T) {
+	// Produced with: go test -gcflags="-m -d=ssa/check_bce" -bench=. -benchmem > build.log 2>&1
+	hints, err := ParseCompilerOutput("testdata/bench/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	mainGo := absPath(t, "testdata", "bench", "main.go")
+	benchTest := absPath(t, "testdata", "bench", "bench_test.go")
+
+	tests := map[string]struct {
+		includeTests bool
+		expected     []string
+	}{
+		"package only": {
+			expected: []string{
+				fmt.Sprintf("variable at %s:14 is marked as no-escape but escapes to heap", mainGo),
+			},
+		},
+		"with tests": {
+			includeTests: true,
+			expected: []string{
+				fmt.Sprintf("variable at %s:16 is marked as no-escape but escapes to heap", benchTest),
+				fmt.Sprintf("variable at %s:14 is marked as no-escape but escapes to heap", mainGo),
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultAnnotationOptions()
+			opts.IncludeTests = tt.includeTests
+
+			annotations, _, err := ParseCodeAnnotations("testdata/bench", opts)
+			if err != nil {
+				t.Fatalf("ParseCodeAnnotations failed: %v", err)
+			}
+
+			var messages []string
+			for _, finding := range CompareResults(hints, annotations, CompareOptions{}).Findings {
+				messages = append(messages, finding.String())
+			}
+
+			if !slices.Equal(messages, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, messages)
+			}
+		})
+	}
+}
+
+func TestCompareResultsMaxAllocs(t *testing.T) {
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	hints, err := ParseCompilerOutput("testdata/maxallocs/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/maxallocs", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The functions under and at their budget pass, and the one over it is
+	// reported once with the number of allocations.
+	mainGo := absPath(t, "testdata", "maxallocs", "main.go")
+	expected := []string{
+		fmt.Sprintf("function at %s:17 is marked as max-allocs=3 but has 4 heap allocations", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+
+	if stats := report.Kinds[MaxAllocs]; stats.Passed != 2 || stats.Failed != 1 {
+		t.Errorf("expected 2 passed and 1 failed, got %+v", stats)
+	}
+}
+
+func TestCompareResultsClosure(t *testing.T) {
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	hints, err := ParseCompilerOutput("testdata/closure/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/closure", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The closure passed to apply is inlined along with it, while the one
+	// stored in the slice is allocated on the heap.
+	mainGo := absPath(t, "testdata", "closure", "main.go")
+	expected := []string{
+		fmt.Sprintf("variable at %s:13 is marked as no-escape but escapes to heap", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestCompareResultsColumn(t *testing.T) {
+	compilerHints := map[Position][]CompilerHint{
+		{File: "main.go", Line: 10}: {MovedToHeap},
+		{File: "main.go", Line: 20}: {EscapesToHeap},
+		{File: "main.go", Line: 22}: {EscapesToHeap},
+	}
+
+	codeAnnotations := map[Position][]Annotation{
+		{File: "main.go", Line: 10}: {{Kind: NoEscape, Column: 12}},
+		{File: "main.go", Line: 20}: {{Kind: NoEscapeFunc, EndLine: 25, Column: 23}},
+	}
+
+	report := CompareResults(kindHints(compilerHints), codeAnnotations, CompareOptions{})
+
+	// The column points at the comment, so it is only known for the findings
+	// at the line of the annotation.
+	columns := make(map[int]int)
+	for _, finding := range report.Findings {
+		columns[finding.Position.Line] = finding.Column
+	}
+
+	expected := map[int]int{10: 12, 20: 23, 22: 0}
+	if !maps.Equal(columns, expected) {
+		t.Errorf("expected columns %v, got %v", expected, columns)
+	}
+}
+
+func TestCompareResultsReceiver(t *testing.T) {
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	hints, err := ParseCompilerOutput("testdata/receiver/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("testdata/receiver", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.String())
+	}
+
+	// The receiver of inc does not escape, and the one of self only flows to
+	// the result, while remember stores its receiver in a global variable.
+	mainGo := absPath(t, "testdata", "receiver", "main.go")
+	expected := []string{
+		fmt.Sprintf("variable at %s:11 is marked as no-escape:c but escapes to heap", mainGo),
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
@@ -0,0 +1,473 @@
+package escapelint
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type CompilerHint string
+
+const (
+	EscapesToHeap   CompilerHint = "escapes-to-heap"
+	MovedToHeap     CompilerHint = "moved-to-heap"
+	StaysOnStack    CompilerHint = "stays-on-stack"
+	DoesNotEscape   CompilerHint = "does-not-escape"
+	FoundIsInBounds CompilerHint = "found-is-in-bounds"
+	Inlined         CompilerHint = "inlined"
+	CanInline       CompilerHint = "can-inline"
+	CannotInline    CompilerHint = "cannot-inline"
+	LeakingParam    CompilerHint = "leaking-param"
+	LeaksToResult   CompilerHint = "leaks-to-result"
+)
+
+// knownHints lists the hints that can be required with an expect annotation.
+// The hints of the custom rules have annotations of their own.
+var knownHints = []CompilerHint{
+	EscapesToHeap,
+	MovedToHeap,
+	StaysOnStack,
+	DoesNotEscape,
+	FoundIsInBounds,
+	Inlined,
+	CanInline,
+	CannotInline,
+	LeakingParam,
+	LeaksToResult,
+}
+
+// hintNames returns the known hints as a comma-separated list, for the errors
+// about unknown ones.
+func hintNames() string {
+	names := make([]string, len(knownHints))
+	for i, hint := range knownHints {
+		names[i] = string(hint)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Hint is a single compiler message classified as one of the CompilerHint kinds.
+type Hint struct {
+	Kind CompilerHint
+
+	// Symbol is what the message is about, such as the variable moved to heap,
+	// the escaping expression or the inlined function. It is empty if the
+	// message does not name anything.
+	Symbol string
+
+	// Cost and Budget are the inlining cost of a function that is too complex
+	// to be inlined, and the budget it exceeds. They are zero otherwise.
+	Cost   int
+	Budget int
+
+	// Raw is the line of the compiler output the hint was parsed from, or the
+	// message of a JSON diagnostic, to show what the compiler actually said.
+	// It is not part of the identity of the hint.
+	Raw string
+}
+
+// hasHint reports whether any of the hints is of one of the kinds.
+func hasHint(hints []Hint, kinds ...CompilerHint) bool {
+	return slices.ContainsFunc(hints, func(h Hint) bool { return slices.Contains(kinds, h.Kind) })
+}
+
+// phrasePattern matches a message with the phrase either as its subject, as in
+// "moved to heap: x", or as its predicate, as in "x escapes to heap", and
+// captures the symbol named on the other side.
+func phrasePattern(phrase string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + phrase + `(?:: (?P<symbol>.+))?|^(?:(?P<symbol>.+) )?` + phrase + `$`)
+}
+
+// hintPatterns classify the compiler messages, in priority order. The patterns
+// are matched against the message following the "file:line:col: " prefix. A
+// phrase is either the subject of the message ("moved to heap: x") or its
+// predicate ("x escapes to heap"), so it is anchored at one of the ends. The
+// groups named "symbol" capture what the message is about, and the ones named
+// "cost" and "budget" capture the numbers of the inlining decision.
+//
+// None of the patterns depend on the -m level. The explanations added at -m=2,
+// such as "x escapes to heap in f:" and the "flow:" lines following it, are
+// left unclassified, since the conclusion is reported on its own either way,
+// e.g. as "moved to heap: x". The details of the leaking parameters are parsed
+// as the same hints as the "leaking param" messages that follow them.
+var hintPatterns = []struct {
+	pattern *regexp.Regexp
+	hint    CompilerHint
+}{
+	{phrasePattern(`escapes to heap`), EscapesToHeap},
+	{phrasePattern(`moved to heap`), MovedToHeap},
+	{phrasePattern(`stays on stack`), StaysOnStack},
+	{phrasePattern(`does not escape`), DoesNotEscape},
+	{regexp.MustCompile(`^leaking param: (?P<symbol>\S+) to result`), LeaksToResult},
+	{regexp.MustCompile(`^leaking param: (?P<symbol>\S+)$`), LeakingParam},
+	{regexp.MustCompile(`^parameter (?P<symbol>\S+) leaks to ~r\d+ for `), LeaksToResult},
+	{regexp.MustCompile(`^parameter (?P<symbol>\S+) leaks to \{heap\} for `), LeakingParam},
+	{regexp.MustCompile(`^inlining call(?: to (?P<symbol>.+))?`), Inlined},
+	{regexp.MustCompile(`^can inline (?P<symbol>\S+)`), CanInline},
+	{regexp.MustCompile(`^cannot inline (?P<symbol>[^\s:]+):(?: function too complex: cost (?P<cost>\d+) exceeds budget (?P<budget>\d+))?`), CannotInline},
+	{regexp.MustCompile(`^Found IsInBounds`), FoundIsInBounds},
+}
+
+// addressOfPattern matches the address of a variable, as in "&x escapes to heap"
+// or "... &buf escapes to heap", capturing the name of the variable. Only Go 1.12
+// and earlier report the addresses, the later versions report the variable moved
+// to heap at its declaration instead.
+var addressOfPattern = regexp.MustCompile(`^(?:\.\.\. )?&([\p{L}_][\p{L}\p{N}_]*)$`)
+
+// addressedSymbol returns the variable whose address the symbol is, so that
+// the hint is about the variable named by the annotations, or the symbol as is.
+// The addresses of composite literals, such as "&point{...}", are left intact.
+func addressedSymbol(symbol string) string {
+	if m := addressOfPattern.FindStringSubmatch(symbol); m != nil {
+		return m[1]
+	}
+
+	return symbol
+}
+
+// classifyMessage returns the hint of the first pattern matching the message.
+func classifyMessage(message string) (Hint, bool) {
+	for _, p := range hintPatterns {
+		match := p.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+
+		hint := Hint{Kind: p.hint}
+
+		for i, name := range p.pattern.SubexpNames() {
+			if match[i] == "" {
+				continue
+			}
+
+			switch name {
+			case "symbol":
+				hint.Symbol = cmp.Or(hint.Symbol, addressedSymbol(match[i]))
+			case "cost":
+				hint.Cost, _ = strconv.Atoi(match[i])
+			case "budget":
+				hint.Budget, _ = strconv.Atoi(match[i])
+			}
+		}
+
+		return hint, true
+	}
+
+	return Hint{}, false
+}
+
+// positionPattern matches a "file.go:line[:col]" position anywhere in a line,
+// either followed by ": " and the message, or enclosed in parentheses or ending
+// the line after the message. The file and the line number are captured. The
+// position may directly follow a bracketed prefix, such as "[build]".
+var positionPattern = regexp.MustCompile(`(?:^|[\s(\]])([^\s()\[\]]+\.go):(\d+)(?::\d+)?(?:(: )|\)|$)`)
+
+// testLogPattern matches the lines logged by tests and benchmarks, e.g. with
+// b.Logf, which go test prints indented under the position of the call. They
+// are mixed with the compiler diagnostics in the output of go test -gcflags=-m.
+var testLogPattern = regexp.MustCompile(`^\s+\S+_test\.go:\d+: `)
+
+// ansiEscape matches the color codes that CI systems often add to the logs.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// splitCompilerLine finds the position in a line of the compiler output and
+// returns it along with the message. Besides the usual "file:line:col: message",
+// the position may be preceded by a timestamp or other noise added by wrappers,
+// or follow the message as in "message (file:line:col)".
+func splitCompilerLine(line string) (file, lineNum, message string, ok bool) {
+	if strings.Contains(line, "\x1b") {
+		line = ansiEscape.ReplaceAllString(line, "")
+	}
+
+	m := positionPattern.FindStringSubmatchIndex(line)
+	if m == nil {
+		return "", "", "", false
+	}
+
+	file, lineNum = line[m[2]:m[3]], line[m[4]:m[5]]
+
+	if m[6] != -1 {
+		return file, lineNum, line[m[1]:], true
+	}
+
+	return file, lineNum, strings.TrimSpace(line[:m[0]]), true
+}
+
+// parseCompilerLine extracts the compiler hints from a single line of the text
+// compiler output, including the ones of the custom rules.
+// Only the message next to the "file:line:col" position is classified, so that
+// unrelated lines of a build log mentioning the same phrases are not misread.
+func parseCompilerLine(line, dirname string) (Position, []Hint, error) {
+	if testLogPattern.MatchString(line) {
+		return Position{}, nil, nil
+	}
+
+	file, lineStr, message, found := splitCompilerLine(line)
+	if !found {
+		return Position{}, nil, nil
+	}
+
+	var hints []Hint
+
+	if hint, ok := classifyMessage(message); ok {
+		hint.Raw = line
+		hints = append(hints, hint)
+	}
+
+	for _, kind := range matchRules(message) {
+		hints = append(hints, Hint{Kind: kind, Raw: line})
+	}
+
+	if len(hints) == 0 {
+		return Position{}, nil, nil
+	}
+
+	lineNum, err := strconv.Atoi(lineStr)
+	if err != nil {
+		return Position{}, nil, fmt.Errorf("invalid line number in %s:%s: %w", file, lineStr, err)
+	}
+
+	normalizedFile := normalizePath(filepath.Join(dirname, filepath.FromSlash(file)))
+
+	return Position{File: normalizedFile, Line: lineNum}, hints, nil
+}
+
+// ParseCompilerOutput reads the text output of the compiler. When several files
+// are given, e.g. produced by builds for different platforms, the hints found at
+// the same position in each of them are merged together.
+func ParseCompilerOutput(filePaths ...string) (map[Position][]Hint, error) {
+	results := make(map[Position][]Hint)
+
+	for _, filePath := range filePaths {
+		if err := parseCompilerFile(filePath, results); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func parseCompilerFile(filePath string, results map[Position][]Hint) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	r, err := decompress(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	if err := parseCompilerReader(r, filepath.Dir(filePath), results); err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns a reader of the decompressed data if the input is gzipped,
+// as the build logs stored by CI systems often are, or of the input as is.
+// The format is told by the content rather than the file name.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	return zr, nil
+}
+
+// parseCompilerReader reads the text compiler output, resolving the file names
+// relative to dirname, and adds the hints found to results. Build logs may have
+// unrelated lines that look like diagnostics, so the lines that cannot be parsed
+// are skipped rather than failing the whole input.
+func parseCompilerReader(r io.Reader, dirname string, results map[Position][]Hint) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MaxLineLength)
+	scannerLine := 1
+
+	for scanner.Scan() {
+		pos, hints, err := parseCompilerLine(scanner.Text(), dirname)
+		if err != nil {
+			debugf("skipping unparseable compiler output at line %d: %s", scannerLine, err)
+		}
+
+		for _, hint := range hints {
+			addHint(results, pos, hint)
+		}
+
+		scannerLine++
+	}
+
+	return scanner.Err()
+}
+
+// addHint stores the hint at the position, unless it is already there. The same
+// hint may be reported several times, e.g. with -m=2 or by multiple builds, in
+// which case the first line reporting it is kept.
+func addHint(results map[Position][]Hint, pos Position, hint Hint) {
+	if slices.ContainsFunc(results[pos], hint.sameAs) {
+		return
+	}
+
+	debugf("found %s at %s:%d: %s", hint.Kind, pos.File, pos.Line, hint.Raw)
+	results[pos] = append(results[pos], hint)
+}
+
+// sameAs reports whether both hints say the same thing, regardless of the lines
+// they were parsed from.
+func (h Hint) sameAs(other Hint) bool {
+	h.Raw, other.Raw = "", ""
+	return h == other
+}
+
+// jsonDiagnosticHints maps the codes of the compiler JSON diagnostics to hints.
+// Note that the JSON output reports variables moved to heap as escaping.
+var jsonDiagnosticHints = map[string]CompilerHint{
+	"escape":     EscapesToHeap,
+	"inlineCall": Inlined,
+	"isInBounds": FoundIsInBounds,
+}
+
+// jsonDiagnosticHint returns the hint of a JSON diagnostic. The message of an
+// inlined call is the name of the function, while the escape messages are the
+// same as in the text output.
+func jsonDiagnosticHint(kind CompilerHint, message string) Hint {
+	switch kind {
+	case Inlined:
+		return Hint{Kind: kind, Symbol: message, Raw: message}
+	case EscapesToHeap:
+		if hint, ok := classifyMessage(message); ok {
+			return Hint{Kind: kind, Symbol: hint.Symbol, Raw: message}
+		}
+	}
+
+	return Hint{Kind: kind, Raw: message}
+}
+
+// compilerJSONEntry is a single JSON value in the compiler output. It is either
+// a header preceding the diagnostics for a source file, a diagnostic itself
+// (both produced with -gcflags=-json), or a "go build -json" event.
+type compilerJSONEntry struct {
+	File    string `json:"file"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Range   struct {
+		Start struct {
+			Line int `json:"line"`
+		} `json:"start"`
+	} `json:"range"`
+	Action string `json:"Action"`
+	Output string `json:"Output"`
+}
+
+// ParseCompilerJSON reads the diagnostics produced with -gcflags=-json=0,file://<dir>
+// or the output of "go build -json". Each input path can be either a single file
+// or a directory, which is then searched for *.json files. The hints from all
+// inputs are merged together.
+func ParseCompilerJSON(inputPaths ...string) (map[Position][]Hint, error) {
+	results := make(map[Position][]Hint)
+
+	for _, inputPath := range inputPaths {
+		err := filepath.WalkDir(inputPath, func(currentPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || (currentPath != inputPath && !strings.HasSuffix(currentPath, ".json")) {
+				return nil
+			}
+
+			return parseCompilerJSONFile(currentPath, results)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func parseCompilerJSONFile(filePath string, results map[Position][]Hint) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	r, err := decompress(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	decoder := json.NewDecoder(r)
+	dirname := filepath.Dir(filePath)
+	currentFile := ""
+
+	for {
+		var entry compilerJSONEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", filePath, err)
+		}
+
+		switch {
+		case entry.Action == "build-output":
+			for _, line := range strings.Split(entry.Output, "\n") {
+				pos, hints, err := parseCompilerLine(line, dirname)
+				if err != nil {
+					debugf("skipping unparseable compiler output in %s: %s", filePath, err)
+				}
+
+				for _, hint := range hints {
+					addHint(results, pos, hint)
+				}
+			}
+		case entry.File != "":
+			currentFile = normalizePath(entry.File)
+		case entry.Code != "" && currentFile != "":
+			pos := Position{File: currentFile, Line: entry.Range.Start.Line}
+
+			if kind := jsonDiagnosticHints[entry.Code]; kind != "" {
+				addHint(results, pos, jsonDiagnosticHint(kind, entry.Message))
+			}
+
+			for _, kind := range matchRules(entry.Message) {
+				addHint(results, pos, Hint{Kind: kind, Raw: entry.Message})
+			}
+		}
+	}
+
+	return nil
+}
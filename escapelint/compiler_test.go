@@ -0,0 +1,639 @@
+package escapelint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hintKinds returns the kinds of the hints, leaving out the symbols.
+func hintKinds(hints map[Position][]Hint) map[Position][]CompilerHint {
+	kinds := make(map[Position][]CompilerHint, len(hints))
+
+	for pos, posHints := range hints {
+		for _, hint := range posHints {
+			kinds[pos] = append(kinds[pos], hint.Kind)
+		}
+	}
+
+	return kinds
+}
+
+// withoutRaw returns the hints without the lines they were parsed from.
+func withoutRaw(hints map[Position][]Hint) map[Position][]Hint {
+	stripped := make(map[Position][]Hint, len(hints))
+
+	for pos, posHints := range hints {
+		for _, hint := range posHints {
+			hint.Raw = ""
+			stripped[pos] = append(stripped[pos], hint)
+		}
+	}
+
+	return stripped
+}
+
+func TestParseCompilerOutput(t *testing.T) {
+	// Create a temporary directory.
+	tmpDir := t.TempDir()
+
+	// Create a temporary file with compiler output.
+	compilerOutput := `
+main.go:10: moved to heap: main
+main.go:15: escapes to heap: main
+main.go:20: stays on stack: main
+main.go:25: inlining call: main
+main.go:30: Found IsInBounds
+`
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	// Call ParseCompilerOutput with the temp file.
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	// Create expected results with normalized paths.
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 15}: {EscapesToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 20}: {StaysOnStack},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 25}: {Inlined},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 30}: {FoundIsInBounds},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []Hint
+	}{
+		{line: "./main.go:8:2: moved to heap: x", expected: []Hint{{Kind: MovedToHeap, Symbol: "x"}}},
+		{line: "./main.go:9:9: &x escapes to heap", expected: []Hint{{Kind: EscapesToHeap, Symbol: "x"}}},
+		{line: "./main.go:14:9: ... &buf escapes to heap", expected: []Hint{{Kind: EscapesToHeap, Symbol: "buf"}}},
+		{line: "./main.go:14:9: &point{...} escapes to heap", expected: []Hint{{Kind: EscapesToHeap, Symbol: "&point{...}"}}},
+		{line: "./main.go:14:9: &p.buf does not escape", expected: []Hint{{Kind: DoesNotEscape, Symbol: "&p.buf"}}},
+		{line: "main.go:15: escapes to heap: main", expected: []Hint{{Kind: EscapesToHeap, Symbol: "main"}}},
+		{line: "main.go:20: stays on stack: main", expected: []Hint{{Kind: StaysOnStack, Symbol: "main"}}},
+		{line: "./main.go:13:13: make([]byte, 64) does not escape", expected: []Hint{{Kind: DoesNotEscape, Symbol: "make([]byte, 64)"}}},
+		{line: "./main.go:14:9: inlining call to add", expected: []Hint{{Kind: Inlined, Symbol: "add"}}},
+		{line: "./main.go:15:10: Found IsInBounds", expected: []Hint{{Kind: FoundIsInBounds}}},
+		{line: "./main.go:16:2: escapes to heap", expected: []Hint{{Kind: EscapesToHeap}}},
+		{line: "./main.go:13:30: func literal escapes to heap", expected: []Hint{{Kind: EscapesToHeap, Symbol: "func literal"}}},
+		{line: "./main.go:12:12: func literal does not escape", expected: []Hint{{Kind: DoesNotEscape, Symbol: "func literal"}}},
+		{line: "./main.go:10:2: x escapes to heap in leak:", expected: nil},
+		{line: "./main.go:3:6: can inline add", expected: []Hint{{Kind: CanInline, Symbol: "add"}}},
+		{line: "./main.go:3:6: can inline add with cost 4 as: func(int, int) int { return a + b }", expected: []Hint{{Kind: CanInline, Symbol: "add"}}},
+		{line: "./main.go:11:6: cannot inline sum: unhandled op DEFER", expected: []Hint{{Kind: CannotInline, Symbol: "sum"}}},
+		{
+			line:     "./main.go:3:6: cannot inline (*T).Sum: function too complex: cost 120 exceeds budget 80",
+			expected: []Hint{{Kind: CannotInline, Symbol: "(*T).Sum", Cost: 120, Budget: 80}},
+		},
+		{line: "./main.go:7:6: leaking param: p", expected: []Hint{{Kind: LeakingParam, Symbol: "p"}}},
+		{line: "./main.go:15:7: leaking param: c to result ~r0 level=0", expected: []Hint{{Kind: LeaksToResult, Symbol: "c"}}},
+		{line: "./main.go:7:6: leaking param content: p", expected: nil},
+		{line: "./main.go:16:12: parameter p leaks to {heap} for store with derefs=0:", expected: []Hint{{Kind: LeakingParam, Symbol: "p"}}},
+		{line: "./main.go:12:15: parameter p leaks to ~r0 for identity with derefs=0:", expected: []Hint{{Kind: LeaksToResult, Symbol: "p"}}},
+		{line: "./main.go:6:11: parameter n leaks to {storage for func literal} for leak with derefs=0:", expected: nil},
+		{line: "./main.go:8:2: p escapes to heap in newPoint:", expected: nil},
+		{line: "./main.go:8:2:   flow: ~r0 ← &p:", expected: nil},
+		{line: "./main.go:8:2:     from &p (address-of) at ./main.go:9:9", expected: nil},
+		{line: "2024/01/01 12:00:00 note: inlining call to foo", expected: nil},
+		{line: "2024-01-01 main.go:10:6: escapes to heap: x", expected: []Hint{{Kind: EscapesToHeap, Symbol: "x"}}},
+		{line: "x escapes to heap (main.go:10:6)", expected: []Hint{{Kind: EscapesToHeap, Symbol: "x"}}},
+		{line: "moved to heap: x (./main.go:10:2)", expected: []Hint{{Kind: MovedToHeap, Symbol: "x"}}},
+		{line: "note: main.go is not inlined", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			_, hints, err := parseCompilerLine(tt.line, "")
+			if err != nil {
+				t.Fatalf("parseCompilerLine failed: %v", err)
+			}
+
+			for i := range hints {
+				if hints[i].Raw != tt.line {
+					t.Errorf("expected the raw line %q, got %q", tt.line, hints[i].Raw)
+				}
+
+				hints[i].Raw = ""
+			}
+
+			if !reflect.DeepEqual(hints, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, hints)
+			}
+		})
+	}
+}
+
+func TestParseCompilerOutputMultipleFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	amd64Output := `
+main.go:10:2: moved to heap: x
+main.go:20:9: inlining call to foo
+`
+	arm64Output := `
+main.go:10:2: moved to heap: x
+main.go:30:10: Found IsInBounds
+`
+	amd64File := filepath.Join(tmpDir, "amd64.log")
+	if err := os.WriteFile(amd64File, []byte(amd64Output), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	arm64File := filepath.Join(tmpDir, "arm64.log")
+	if err := os.WriteFile(arm64File, []byte(arm64Output), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(amd64File, arm64File)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 20}: {Inlined},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 30}: {FoundIsInBounds},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputMisleadingLines(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	compilerOutput := `
+# example
+main.go:10:2: x escapes to heap in leak:
+main.go:10:2:   flow: ~r0 ← &x:
+main.go:10:2: moved to heap: x
+main.go:20:2: "escapes to heap" is mentioned in a string
+--- FAIL: TestAlloc (0.00s): buffer escapes to heap
+2024/01/01 12:00:00 note: inlining call to foo
+`
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputLogPrefixes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	compilerOutput := "[build] 12:00:01 main.go:10:2: moved to heap: x\n" +
+		"2024-01-01T12:00:02.1234567Z ./main.go:14:9: inlining call to add\n" +
+		"[compile]main.go:15:10: Found IsInBounds\n" +
+		"\x1b[36m[build]\x1b[0m \x1b[1mmain.go:20:9: &y escapes to heap\x1b[0m\n" +
+		"[build] 12:00:03 ok\n"
+
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 14}: {Inlined},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 15}: {FoundIsInBounds},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 20}: {EscapesToHeap},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputBenchmarks(t *testing.T) {
+	// Produced with: go test -gcflags="-m -d=ssa/check_bce" -bench=. -benchmem > build.log 2>&1
+	results, err := ParseCompilerOutput("testdata/bench/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	// The hints in the test files are at the same positions as in the package,
+	// and the benchmark results are skipped.
+	benchTest := absPath(t, "testdata", "bench", "bench_test.go")
+	expected := map[Position][]CompilerHint{
+		{File: benchTest, Line: 8}:  {DoesNotEscape},
+		{File: benchTest, Line: 16}: {Inlined, MovedToHeap},
+	}
+
+	for pos, kinds := range expected {
+		if got := hintKinds(results)[pos]; !reflect.DeepEqual(got, kinds) {
+			t.Errorf("expected %v at line %d, got %v", kinds, pos.Line, got)
+		}
+	}
+
+	for pos := range results {
+		if !strings.HasSuffix(pos.File, ".go") {
+			t.Errorf("unexpected hints at %s:%d", pos.File, pos.Line)
+		}
+	}
+
+	// The lines logged by the benchmarks are not diagnostics, even if they
+	// read like ones.
+	tmpDir := t.TempDir()
+
+	testOutput := "./bench_test.go:16:18: moved to heap: p\n" +
+		"BenchmarkNewPoint-8 \t     100\t        36.17 ns/op\t      16 B/op\t       1 allocs/op\n" +
+		"--- BENCH: BenchmarkNewPoint-8\n" +
+		"    bench_test.go:20: the buffer escapes to heap\n"
+
+	tmpFile := filepath.Join(tmpDir, "build.log")
+	if err := os.WriteFile(tmpFile, []byte(testOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	if results, err = ParseCompilerOutput(tmpFile); err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected = map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "bench_test.go"), Line: 16}: {MovedToHeap},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, hintKinds(results))
+	}
+}
+
+func TestParseCompilerOutputDoesNotEscape(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	compilerOutput := `
+./main.go:13:13: make([]byte, 64) does not escape
+./main.go:14:10: make(map[string]int) does not escape
+./main.go:20:11: leaking param: b
+./main.go:20:14: c does not escape
+./main.go:25:7: func literal does not escape
+`
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 13}: {DoesNotEscape},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 14}: {DoesNotEscape},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 20}: {LeakingParam, DoesNotEscape},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 25}: {DoesNotEscape},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputMalformedLines(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	compilerOutput := `
+main.go:10:2: moved to heap: x
+main.go:x: escapes to heap
+progress:50%: inlining call to foo
+main.go:15:10: Found IsInBounds
+`
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 15}: {FoundIsInBounds},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputGenerics(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A generic function is compiled once per shape, and each of the instantiations
+	// is reported at the same position: here, with a value and with a pointer type.
+	compilerOutput := `
+./main.go:12:13: make([]go.shape.int, 8) does not escape
+./main.go:12:13: make([]go.shape.*uint8, 8) escapes to heap
+./main.go:20:9: new(go.shape.int) does not escape
+./main.go:20:9: new(go.shape.string) does not escape
+`
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+
+	expected := map[Position][]Hint{
+		{File: mainGoFile, Line: 12}: {
+			{Kind: DoesNotEscape, Symbol: "make([]go.shape.int, 8)"},
+			{Kind: EscapesToHeap, Symbol: "make([]go.shape.*uint8, 8)"},
+		},
+		{File: mainGoFile, Line: 20}: {
+			{Kind: DoesNotEscape, Symbol: "new(go.shape.int)"},
+			{Kind: DoesNotEscape, Symbol: "new(go.shape.string)"},
+		},
+	}
+
+	if !reflect.DeepEqual(withoutRaw(results), expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+
+	// The annotation fails if any of the instantiations escapes.
+	report := CompareResults(results, map[Position][]Annotation{
+		{File: mainGoFile, Line: 12}: {{Kind: NoEscape}},
+		{File: mainGoFile, Line: 20}: {{Kind: NoEscape}},
+	}, CompareOptions{})
+
+	if len(report.Findings) != 1 || report.Findings[0].Position.Line != 12 {
+		t.Errorf("expected a single finding at line 12, got %v", report.Findings)
+	}
+}
+
+func TestParseCompilerOutputDuplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	compilerOutput := `
+./main.go:10:2: x escapes to heap
+./main.go:10:2: x escapes to heap
+./main.go:10:9: y escapes to heap
+./main.go:10:9: inlining call to foo
+`
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	// The same message is stored once, while the messages about different
+	// values at the same position are kept apart, along with their lines.
+	expected := map[Position][]Hint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {
+			{Kind: EscapesToHeap, Symbol: "x", Raw: "./main.go:10:2: x escapes to heap"},
+			{Kind: EscapesToHeap, Symbol: "y", Raw: "./main.go:10:9: y escapes to heap"},
+			{Kind: Inlined, Symbol: "foo", Raw: "./main.go:10:9: inlining call to foo"},
+		},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputGzip(t *testing.T) {
+	expected, err := ParseCompilerOutput("testdata/example/build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	results, err := ParseCompilerOutput("testdata/example/build.log.gz")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	if len(results) == 0 || !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerOutputLongLines(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	longName := strings.Repeat("x", 100*1024)
+	compilerOutput := "main.go:10:2: moved to heap: " + longName + "\nmain.go:11:2: moved to heap: y\n"
+
+	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
+	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerOutput(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 11}: {MovedToHeap},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseDotSlashPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	compilerOutput := `
+./main.go:5:6: moved to heap: a
+./sub/../main.go:6:6: moved to heap: b
+`
+	mainGo := `
+package main
+
+func main() {
+	var a int //no-escape
+	var b int //no-escape
+}
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "build.log"), []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write build.log: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write main.go: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	hints, err := ParseCompilerOutput("./build.log")
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, _, err := ParseCodeAnnotations("./", DefaultAnnotationOptions())
+	if err != nil {
+		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+	}
+
+	if len(annotations) != 2 {
+		t.Fatalf("expected 2 annotations, got %v", annotations)
+	}
+
+	for pos := range annotations {
+		if _, ok := hints[pos]; !ok {
+			t.Errorf("annotation at %v has no matching hint, hints: %v", pos, hints)
+		}
+	}
+}
+
+func TestParseCompilerJSON(t *testing.T) {
+	// Captured with go1.27: go build -gcflags='-json=0,file:///tmp/out -d=ssa/check_bce'
+	results, err := ParseCompilerJSON("testdata/compiler_output.json")
+	if err != nil {
+		t.Fatalf("ParseCompilerJSON failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: "/go/src/example/main.go", Line: 10}: {EscapesToHeap},
+		{File: "/go/src/example/main.go", Line: 15}: {FoundIsInBounds},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestParseCompilerJSONDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	fixture, err := os.ReadFile("testdata/compiler_output.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "main"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "main", "main.json"), fixture, 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	results, err := ParseCompilerJSON(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseCompilerJSON failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Errorf("expected hints at 2 positions, got %v", results)
+	}
+}
+
+func TestParseCompilerJSONBuildOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	buildOutput := `{"ImportPath":"example","Action":"build-output","Output":"# example\n./main.go:10:2: moved to heap: x\n./main.go:19:9: inlining call to add\n"}
+{"ImportPath":"example","Action":"build-fail"}
+`
+	tmpFile := filepath.Join(tmpDir, "build.json")
+	if err := os.WriteFile(tmpFile, []byte(buildOutput), 0644); err != nil {
+		t.Fatalf("failed to write to temp file: %v", err)
+	}
+
+	results, err := ParseCompilerJSON(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseCompilerJSON failed: %v", err)
+	}
+
+	expected := map[Position][]CompilerHint{
+		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
+		{File: filepath.Join(tmpDir, "main.go"), Line: 19}: {Inlined},
+	}
+
+	if !reflect.DeepEqual(hintKinds(results), expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func FuzzParseCompilerOutput(f *testing.F) {
+	seeds := []string{
+		"# example.com/pkg\n./main.go:5:6: can inline add\n./main.go:19:9: inlining call to add\n",
+		"./main.go:10:2: moved to heap: x\n./main.go:14:10: b does not escape\n",
+		"./main.go:10:2: x escapes to heap in leak:\n./main.go:10:2:   flow: ~r0 ← &x:\n",
+		"./main.go:15:10: Found IsInBounds\n",
+		"main.go:10: moved to heap: main\n",
+		"main.go:x: escapes to heap\n",
+		":: escapes to heap\n",
+		"main.go: moved to heap\n",
+		": Found IsInBounds",
+		"",
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data string) {
+		results := make(map[Position][]Hint)
+
+		if err := parseCompilerReader(strings.NewReader(data), "pkg", results); err != nil {
+			return
+		}
+
+		for pos, hints := range results {
+			if pos.File == "" {
+				t.Errorf("empty file name in %v", pos)
+			}
+
+			if len(hints) == 0 {
+				t.Errorf("no hints stored at %v", pos)
+			}
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package escapelint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParseDiff reads a unified diff and returns the set of lines added or changed
+// in the new version of each file. File paths are resolved relative to baseDir,
+// and the "b/" prefix used by git is stripped.
+func ParseDiff(r io.Reader, baseDir string) (map[Position]bool, error) {
+	changed := make(map[Position]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MaxLineLength)
+	currentFile := ""
+	lineNum := 0
+	scannerLine := 0
+
+	// The lines of the current hunk still to be read from the old and the new
+	// version. Inside a hunk, a line starting with "+++ " or "--- " is an added
+	// or removed line rather than a file header. The lines of a hunk never
+	// start with "@@" or "diff", so these end it even if the counts are off.
+	oldLeft, newLeft := 0, 0
+	afterOldHeader := false
+
+	for scanner.Scan() {
+		scannerLine++
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "diff ") {
+			oldLeft, newLeft = 0, 0
+		}
+
+		inHunk := oldLeft > 0 || newLeft > 0
+		isNewHeader := afterOldHeader && strings.HasPrefix(line, "+++ ")
+		afterOldHeader = false
+
+		switch {
+		case !inHunk && strings.HasPrefix(line, "--- "):
+			afterOldHeader = true
+		case isNewHeader:
+			name, err := diffFileName(strings.TrimPrefix(line, "+++ "))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse file name at %d: %w", scannerLine, err)
+			}
+
+			currentFile = ""
+
+			if name != "/dev/null" {
+				name = strings.TrimPrefix(name, "b/")
+				currentFile = normalizePath(filepath.Join(baseDir, name))
+			}
+		case strings.HasPrefix(line, "@@ "):
+			start, oldCount, newCount, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse hunk header at %d: %w", scannerLine, err)
+			}
+
+			lineNum, oldLeft, newLeft = start, oldCount, newCount
+		case !inHunk:
+			continue
+		case strings.HasPrefix(line, "+"):
+			if currentFile != "" {
+				changed[Position{File: currentFile, Line: lineNum}] = true
+			}
+
+			lineNum++
+			newLeft--
+		case strings.HasPrefix(line, "-"):
+			oldLeft--
+		case strings.HasPrefix(line, " "), line == "":
+			// Some editors strip the trailing space of empty context lines.
+			lineNum++
+			oldLeft--
+			newLeft--
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
+
+// diffFileName returns the file name from a "+++" header, without the timestamp
+// added by diff, and unquoted if git quoted it for the special characters.
+func diffFileName(header string) (string, error) {
+	name, _, _ := strings.Cut(header, "\t")
+
+	if strings.HasPrefix(name, `"`) {
+		return strconv.Unquote(name)
+	}
+
+	return name, nil
+}
+
+// parseHunkHeader returns the first line of the new file range, and the number
+// of lines in the old and the new range from a hunk header such as
+// "@@ -10,7 +12,8 @@ func main() {". A range without a count has a single line.
+func parseHunkHeader(header string) (start, oldCount, newCount int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+
+	if _, oldCount, err = parseHunkRange(strings.TrimPrefix(fields[1], "-")); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+
+	if start, newCount, err = parseHunkRange(strings.TrimPrefix(fields[2], "+")); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+
+	return start, oldCount, newCount, nil
+}
+
+// parseHunkRange parses a range of a hunk header such as "12,8" or "12".
+func parseHunkRange(r string) (start, count int, err error) {
+	startText, countText, hasCount := strings.Cut(r, ",")
+
+	if start, err = strconv.Atoi(startText); err != nil {
+		return 0, 0, err
+	}
+
+	count = 1
+	if hasCount {
+		if count, err = strconv.Atoi(countText); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return start, count, nil
+}
@@ -0,0 +1,112 @@
+package escapelint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -3,6 +3,7 @@ package main
+ func main() {
+ 	var a int //no-escape
+-	var b int //no-escape
++	var b int //no-escape // changed
++	var c int //no-escape
+ 	var d int //no-escape
+ }
+@@ -20,2 +21,2 @@ func foo() {
+-	bar()
++	bar() //must-inline
+ }
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package main
+-
+`
+
+	changed, err := ParseDiff(strings.NewReader(diff), "pkg")
+	if err != nil {
+		t.Fatalf("ParseDiff failed: %v", err)
+	}
+
+	expected := map[Position]bool{
+		{File: absPath(t, "pkg", "main.go"), Line: 5}:  true,
+		{File: absPath(t, "pkg", "main.go"), Line: 6}:  true,
+		{File: absPath(t, "pkg", "main.go"), Line: 21}: true,
+	}
+
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v, got %v", expected, changed)
+	}
+}
+
+func TestParseDiffMalformedHunk(t *testing.T) {
+	diff := "+++ b/main.go\n@@ garbage @@\n"
+
+	if _, err := ParseDiff(strings.NewReader(diff), ""); err == nil {
+		t.Errorf("expected an error for a malformed hunk header")
+	}
+}
+
+func TestParseDiffHeaderLikeLines(t *testing.T) {
+	// The added "++ x" and the removed "-- y" look like file headers.
+	diff := `--- a/main.go
++++ b/main.go
+@@ -1,4 +1,5 @@
+ package main
+--- y
++++ x
++var a int //no-escape
+ 
+ var b int
+`
+
+	changed, err := ParseDiff(strings.NewReader(diff), "")
+	if err != nil {
+		t.Fatalf("ParseDiff failed: %v", err)
+	}
+
+	expected := map[Position]bool{
+		{File: absPath(t, "main.go"), Line: 2}: true,
+		{File: absPath(t, "main.go"), Line: 3}: true,
+	}
+
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v, got %v", expected, changed)
+	}
+}
+
+func TestParseDiffQuotedName(t *testing.T) {
+	diff := "--- \"a/dir with space/caf\\303\\251.go\"\n+++ \"b/dir with space/caf\\303\\251.go\"\n@@ -0,0 +1 @@\n+package main\n"
+
+	changed, err := ParseDiff(strings.NewReader(diff), "")
+	if err != nil {
+		t.Fatalf("ParseDiff failed: %v", err)
+	}
+
+	expected := map[Position]bool{{File: absPath(t, "dir with space", "café.go"), Line: 1}: true}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v, got %v", expected, changed)
+	}
+}
+
+func TestParseDiffLongLine(t *testing.T) {
+	diff := "--- a/main.go\n+++ b/main.go\n@@ -1 +1,2 @@\n package main\n+var s = \"" + strings.Repeat("x", 100*1024) + "\"\n"
+
+	changed, err := ParseDiff(strings.NewReader(diff), "")
+	if err != nil {
+		t.Fatalf("ParseDiff failed: %v", err)
+	}
+
+	if !changed[Position{File: absPath(t, "main.go"), Line: 2}] {
+		t.Errorf("expected the long line to be changed, got %v", changed)
+	}
+}
@@ -0,0 +1,44 @@
+// Package escapelint verifies that the optimizations expected by the code
+// annotations, such as //no-escape or //must-inline, are actually performed
+// by the compiler, according to its escape analysis output.
+package escapelint
+
+import (
+	"log"
+	"path/filepath"
+)
+
+// Verbose enables logging of details that are normally omitted, such as the
+// lines of compiler output that could not be parsed.
+var Verbose bool
+
+// MaxLineLength limits the length of a single line read from the compiler output
+// or the source code. Both can exceed the default limit of bufio.Scanner, e.g.
+// with -m=2 output or in generated files.
+var MaxLineLength = 1024 * 1024
+
+func debugf(format string, args ...any) {
+	if Verbose {
+		log.Printf(format, args...)
+	}
+}
+
+type Position struct {
+	File string
+	Line int
+}
+
+// normalizePath brings a file path to the canonical form used in positions, so
+// that the compiler output and the source code produce identical keys for the
+// same file, regardless of "./" prefixes, the path separator in use, or the
+// directories the relative paths were given from. The paths are made absolute,
+// unless the working directory cannot be determined.
+func normalizePath(p string) string {
+	p = filepath.FromSlash(p)
+
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+
+	return filepath.Clean(p)
+}
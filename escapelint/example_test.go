@@ -0,0 +1,39 @@
+package escapelint_test
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+func Example() {
+	// Produced with: go build -gcflags="-m -d=ssa/check_bce" 2> build.log
+	hints, err := escapelint.ParseCompilerOutput("testdata/example/build.log")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	annotations, valid, err := escapelint.ParseCodeAnnotations("testdata/example", escapelint.DefaultAnnotationOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !valid || !escapelint.ValidateAnnotations(annotations) {
+		log.Fatal("invalid annotations")
+	}
+
+	report := escapelint.CompareResults(hints, annotations, escapelint.CompareOptions{})
+
+	// The positions hold absolute paths.
+	for _, finding := range report.Findings {
+		fmt.Printf("%s: %s:%d: %s\n", finding.Severity, filepath.Base(finding.Position.File), finding.Position.Line, finding.Message)
+	}
+
+	fmt.Println(report.Summary())
+
+	// Output:
+	// error: main.go:8: is marked as no-escape but escapes to heap
+	// 1 failure across 1 file (3 annotations checked, 0 matched no compiler hints)
+}
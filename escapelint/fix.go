@@ -0,0 +1,159 @@
+package escapelint
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// LineFix replaces a single line of a source file.
+type LineFix struct {
+	Position Position
+	Before   string
+	After    string
+}
+
+// StaleFixes returns the fixes removing the annotations that matched no compiler
+// hints in the report. Other comments on the same lines are kept intact.
+func StaleFixes(report Report) ([]LineFix, error) {
+	stale := make(map[Position][]Annotation)
+	for _, f := range report.Findings {
+		// Removing only the start of a region would leave its end unmatched.
+		if f.Stale && f.Annotation.Kind != NoEscapeBegin {
+			stale[f.Position] = append(stale[f.Position], f.Annotation)
+		}
+	}
+
+	files := make(map[string][]string)
+	fixes := make([]LineFix, 0, len(stale))
+
+	for pos, annotations := range stale {
+		lines, ok := files[pos.File]
+		if !ok {
+			data, err := os.ReadFile(pos.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file: %w", err)
+			}
+
+			lines = strings.Split(string(data), "\n")
+			files[pos.File] = lines
+		}
+
+		if pos.Line < 1 || pos.Line > len(lines) {
+			continue
+		}
+
+		before, crlf := strings.CutSuffix(lines[pos.Line-1], "\r")
+		after := removeAnnotations(before, annotations)
+
+		if after != before {
+			if crlf {
+				before, after = before+"\r", after+"\r"
+			}
+
+			fixes = append(fixes, LineFix{Position: pos, Before: before, After: after})
+		}
+	}
+
+	slices.SortFunc(fixes, func(a, b LineFix) int {
+		return cmp.Or(
+			cmp.Compare(a.Position.File, b.Position.File),
+			cmp.Compare(a.Position.Line, b.Position.Line),
+		)
+	})
+
+	return fixes, nil
+}
+
+// removeAnnotations removes the comments holding the given annotations from the
+// line, along with the whitespace left at the end of it.
+func removeAnnotations(line string, annotations []Annotation) string {
+	i := commentStart(line)
+	if i == -1 {
+		return line
+	}
+
+	code, comment := line[:i], line[i:]
+
+	// A block comment is a segment of its own, followed by the "//" ones.
+	var starts []int
+	blockEnd := 0
+
+	if strings.HasPrefix(comment, "/*") {
+		starts = append(starts, 0)
+
+		if end := strings.Index(comment, "*/"); end != -1 {
+			blockEnd = end + len("*/")
+		}
+	}
+
+	for _, loc := range commentSeparator.FindAllStringIndex(comment[blockEnd:], -1) {
+		starts = append(starts, blockEnd+loc[1]-len("//"))
+	}
+
+	var kept strings.Builder
+
+	for j, start := range starts {
+		end := len(comment)
+		if j+1 < len(starts) {
+			end = starts[j+1]
+		}
+
+		segment := comment[start:end]
+
+		if slices.ContainsFunc(annotations, func(ann Annotation) bool {
+			parsed := parseAnnotations(normalizeComment(strings.TrimSpace(segment)), ann.prefix)
+			return len(parsed) == 1 && parsed[0].sameAs(ann)
+		}) {
+			continue
+		}
+
+		kept.WriteString(segment)
+	}
+
+	return strings.TrimRight(code+kept.String(), " \t")
+}
+
+// sameAs reports whether both annotations are written the same way in the code.
+func (a Annotation) sameAs(b Annotation) bool {
+	return a.Kind == b.Kind && a.Symbol == b.Symbol && a.Allow == b.Allow && a.Reason == b.Reason && slices.Equal(a.Arches, b.Arches)
+}
+
+// ApplyFixes writes the fixes to the source files. A fix is rejected if the line
+// has changed since the fixes were produced.
+func ApplyFixes(fixes []LineFix) error {
+	byFile := make(map[string][]LineFix)
+	for _, fix := range fixes {
+		byFile[fix.Position.File] = append(byFile[fix.Position.File], fix)
+	}
+
+	for filePath, fileFixes := range byFile {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+
+		lines := strings.Split(string(data), "\n")
+
+		for _, fix := range fileFixes {
+			if fix.Position.Line < 1 || fix.Position.Line > len(lines) || lines[fix.Position.Line-1] != fix.Before {
+				return fmt.Errorf("line has changed at %s:%d", filePath, fix.Position.Line)
+			}
+
+			lines[fix.Position.Line-1] = fix.After
+		}
+
+		if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+
+	return nil
+}
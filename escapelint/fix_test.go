@@ -0,0 +1,110 @@
+package escapelint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveAnnotations(t *testing.T) {
+	tests := []struct {
+		line        string
+		annotations []Annotation
+		expected    string
+	}{
+		{
+			line:        "\tx := 42 //no-escape",
+			annotations: []Annotation{{Kind: NoEscape}},
+			expected:    "\tx := 42",
+		},
+		{
+			line:        "\tx := 42 //no-escape: hot path // keep this",
+			annotations: []Annotation{{Kind: NoEscape, Reason: "hot path"}},
+			expected:    "\tx := 42 // keep this",
+		},
+		{
+			line:        "\tfoo() //must-inline //no-escape",
+			annotations: []Annotation{{Kind: NoEscape}},
+			expected:    "\tfoo() //must-inline",
+		},
+		{
+			line:        "\t_ = b[0] //no-bounds-check:amd64 //no-bounds-check",
+			annotations: []Annotation{{Kind: NoBoundsCheck}},
+			expected:    "\t_ = b[0] //no-bounds-check:amd64",
+		},
+		{
+			line:        "\tfoo() //must-inline",
+			annotations: []Annotation{{Kind: NoEscape}},
+			expected:    "\tfoo() //must-inline",
+		},
+		{
+			line:        "\tx := 42 //escape:no-escape //nolint:ineffassign",
+			annotations: []Annotation{{Kind: NoEscape, prefix: "escape:"}},
+			expected:    "\tx := 42 //nolint:ineffassign",
+		},
+		{
+			line:        "\tx := 42 // no-escape // keep this",
+			annotations: []Annotation{{Kind: NoEscape}},
+			expected:    "\tx := 42 // keep this",
+		},
+		{
+			line:        "\tx := 42 /* no-escape */ // keep this",
+			annotations: []Annotation{{Kind: NoEscape}},
+			expected:    "\tx := 42 // keep this",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if result := removeAnnotations(tt.line, tt.annotations); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStaleFixes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainGo := "package main\n\nfunc main() {\n\tx := 42 //no-escape\n\tfoo() //must-inline // keep\n\ty := 1 //no-escape\n}\n"
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	report := Report{
+		Findings: []Finding{
+			{Position: Position{File: mainGoFile, Line: 5}, Annotation: Annotation{Kind: MustInline}, Stale: true},
+			{Position: Position{File: mainGoFile, Line: 4}, Annotation: Annotation{Kind: NoEscape}, Stale: true},
+			{Position: Position{File: mainGoFile, Line: 6}, Annotation: Annotation{Kind: NoEscape}},
+		},
+	}
+
+	fixes, err := StaleFixes(report)
+	if err != nil {
+		t.Fatalf("StaleFixes failed: %v", err)
+	}
+
+	if len(fixes) != 2 || fixes[0].Position.Line != 4 || fixes[1].Position.Line != 5 {
+		t.Fatalf("expected fixes at lines 4 and 5, got %v", fixes)
+	}
+
+	if err := ApplyFixes(fixes); err != nil {
+		t.Fatalf("ApplyFixes failed: %v", err)
+	}
+
+	data, err := os.ReadFile(mainGoFile)
+	if err != nil {
+		t.Fatalf("failed to read main.go: %v", err)
+	}
+
+	expected := "package main\n\nfunc main() {\n\tx := 42\n\tfoo() // keep\n\ty := 1 //no-escape\n}\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, string(data))
+	}
+
+	if err := ApplyFixes(fixes); err == nil {
+		t.Errorf("expected fixes of changed lines to be rejected")
+	}
+}
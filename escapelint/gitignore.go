@@ -0,0 +1,35 @@
+package escapelint
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitIgnored returns the absolute paths of the files and directories ignored
+// by git under the directory. A directory that is ignored as a whole is listed
+// on its own rather than with its files. It returns nil if git is not available
+// or the directory is not in a git repository.
+func gitIgnored(dir string) map[string]bool {
+	dir = normalizePath(dir)
+
+	cmd := exec.Command("git", "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		debugf("not respecting .gitignore in %s: %v", dir, err)
+		return nil
+	}
+
+	ignored := make(map[string]bool)
+
+	for _, path := range bytes.Split(output, []byte{0}) {
+		if len(path) > 0 {
+			ignored[filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(string(path), "/")))] = true
+		}
+	}
+
+	return ignored
+}
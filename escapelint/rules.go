@@ -0,0 +1,93 @@
+package escapelint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// Rule is a custom annotation checked against the compiler messages matching
+// a pattern, for the diagnostics that have no annotation of their own.
+type Rule struct {
+	Name    AnnotationKind
+	Pattern *regexp.Regexp
+
+	// Present tells whether a matching message is required at the annotated
+	// line, rather than forbidden.
+	Present bool
+}
+
+// hint is the compiler hint recorded for the messages matching the rule.
+func (r Rule) hint() CompilerHint {
+	return CompilerHint("rule:" + string(r.Name))
+}
+
+var customRules []Rule
+
+// RegisterRule adds a custom annotation. It must be called before the compiler
+// output and the source code are parsed, since the messages and the comments
+// parsed before are not matched against the rule. Like RegisterChecker, it is
+// safe to call concurrently with the parsing.
+func RegisterRule(rule Rule) error {
+	if err := validAnnotationName(rule.Name); err != nil {
+		return err
+	}
+
+	if rule.Pattern == nil {
+		return errors.New("rule pattern is required")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if slices.Contains(knownAnnotations, rule.Name) {
+		return fmt.Errorf("annotation already exists: %s", rule.Name)
+	}
+
+	knownAnnotations = append(knownAnnotations, rule.Name)
+	customRules = append(customRules, rule)
+
+	return nil
+}
+
+// UnregisterRule removes the rule added by RegisterRule under the name, if any.
+func UnregisterRule(name AnnotationKind) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if i := slices.IndexFunc(customRules, func(rule Rule) bool { return rule.Name == name }); i >= 0 {
+		customRules = slices.Delete(customRules, i, i+1)
+		removeAnnotation(name)
+	}
+}
+
+// lookupRule returns the custom rule registered for the annotation kind.
+func lookupRule(kind AnnotationKind) (Rule, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, rule := range customRules {
+		if rule.Name == kind {
+			return rule, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// matchRules returns the hints of the custom rules matching the compiler message.
+func matchRules(message string) []CompilerHint {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var hints []CompilerHint
+
+	for _, rule := range customRules {
+		if rule.Pattern.MatchString(message) {
+			hints = append(hints, rule.hint())
+		}
+	}
+
+	return hints
+}
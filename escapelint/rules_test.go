@@ -0,0 +1,111 @@
+package escapelint
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func registerTestRule(t *testing.T, rule Rule) {
+	t.Helper()
+
+	if err := RegisterRule(rule); err != nil {
+		t.Fatalf("RegisterRule failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		UnregisterRule(rule.Name)
+	})
+}
+
+func TestCustomRules(t *testing.T) {
+	registerTestRule(t, Rule{Name: "devirtualized", Pattern: regexp.MustCompile(`^devirtualizing `), Present: true})
+	registerTestRule(t, Rule{Name: "no-closure-alloc", Pattern: regexp.MustCompile(`func literal escapes`)})
+
+	tmpDir := t.TempDir()
+
+	mainGo := `
+package main
+
+func main() {
+	r.Read(buf)          //devirtualized
+	w.Write(buf)         //devirtualized
+	go func() {}()       //no-closure-alloc
+	defer func() {}()    //no-closure-alloc
+}
+`
+	compilerOutput := `
+./main.go:5:8: devirtualizing r.Read to *bytes.Reader
+./main.go:6:2: w escapes to heap
+./main.go:7:5: func literal escapes to heap
+./main.go:8:8: func literal does not escape
+`
+	mainGoFile := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
+		t.Fatalf("failed to write to main.go: %v", err)
+	}
+
+	buildLog := filepath.Join(tmpDir, "build.log")
+	if err := os.WriteFile(buildLog, []byte(compilerOutput), 0644); err != nil {
+		t.Fatalf("failed to write to build.log: %v", err)
+	}
+
+	hints, err := ParseCompilerOutput(buildLog)
+	if err != nil {
+		t.Fatalf("ParseCompilerOutput failed: %v", err)
+	}
+
+	annotations, valid, err := ParseCodeAnnotations(tmpDir, DefaultAnnotationOptions())
+	if err != nil || !valid {
+		t.Fatalf("ParseCodeAnnotations failed: %v (valid=%v)", err, valid)
+	}
+
+	report := CompareResults(hints, annotations, CompareOptions{})
+
+	var messages []string
+	for _, finding := range report.Findings {
+		messages = append(messages, finding.Message)
+	}
+
+	expected := []string{
+		`is marked as devirtualized but has no compiler output matching "^devirtualizing "`,
+		`is marked as no-closure-alloc but has compiler output matching "func literal escapes"`,
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestRegisterRuleErrors(t *testing.T) {
+	tests := []Rule{
+		{Name: "", Pattern: regexp.MustCompile(`x`)},
+		{Name: "no escape", Pattern: regexp.MustCompile(`x`)},
+		{Name: "max=1", Pattern: regexp.MustCompile(`x`)},
+		{Name: NoEscape, Pattern: regexp.MustCompile(`x`)},
+		{Name: "custom"},
+	}
+
+	for _, rule := range tests {
+		if err := RegisterRule(rule); err == nil {
+			t.Errorf("expected an error for %+v", rule)
+		}
+	}
+}
+
+func TestUnregisterRule(t *testing.T) {
+	if err := RegisterRule(Rule{Name: "devirtualized", Pattern: regexp.MustCompile(`^devirtualizing `)}); err != nil {
+		t.Fatalf("RegisterRule failed: %v", err)
+	}
+
+	UnregisterRule("devirtualized")
+
+	if IsKnownAnnotation("devirtualized") || len(matchRules("devirtualizing r.Read to *bytes.Reader")) != 0 {
+		t.Errorf("expected the rule to be removed")
+	}
+
+	// The name can be taken again once it is free.
+	registerTestRule(t, Rule{Name: "devirtualized", Pattern: regexp.MustCompile(`^devirtualizing `)})
+}
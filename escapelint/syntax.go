@@ -0,0 +1,410 @@
+package escapelint
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// funcLineRanges maps the first line of every function declaration and function
+// literal in the file to the last line of its body. When several functions start
+// on the same line, the outermost one wins. The file is read unless its source
+// is given.
+func funcLineRanges(filePath string, src []byte) (map[int]int, error) {
+	fset := token.NewFileSet()
+
+	// A file with syntax errors still yields a partial tree, which is good
+	// enough to find the functions that were parsed.
+	file, err := parser.ParseFile(fset, filePath, src, parser.SkipObjectResolution)
+	if file == nil {
+		return nil, err
+	}
+
+	ranges := make(map[int]int)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		var body *ast.BlockStmt
+
+		switch fn := node.(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+
+		if body == nil {
+			return true
+		}
+
+		start := fset.Position(node.Pos()).Line
+		if _, ok := ranges[start]; !ok {
+			ranges[start] = fset.Position(body.End()).Line
+		}
+
+		return true
+	})
+
+	return ranges, err
+}
+
+// lineSpan is a range of lines, both ends included.
+type lineSpan struct {
+	Start, End int
+}
+
+// statementSpans maps every line of the simple statements spanning several lines
+// in the file, such as a call with its arguments wrapped or a chain of method
+// calls, to the lines of the whole statement. Likewise, the lines of a variable
+// declaration and of the header of an if, for, switch or select statement are
+// mapped to the lines of the declaration or the header. The lines within the
+// body of a function literal belong to the statements of the body rather than
+// to the enclosing one.
+func statementSpans(filePath string, src []byte) (map[int]lineSpan, error) {
+	fset := token.NewFileSet()
+
+	file, err := parser.ParseFile(fset, filePath, src, parser.SkipObjectResolution)
+	if file == nil {
+		return nil, err
+	}
+
+	spans := make(map[int]lineSpan)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node == nil {
+			return true
+		}
+
+		end := node.End()
+
+		switch stmt := node.(type) {
+		case *ast.AssignStmt, *ast.ExprStmt, *ast.ReturnStmt, *ast.GoStmt,
+			*ast.DeferStmt, *ast.SendStmt, *ast.IncDecStmt:
+		case *ast.GenDecl:
+			// The fields of a struct type are annotated on their own.
+			if stmt.Tok != token.VAR {
+				return true
+			}
+		case *ast.IfStmt:
+			end = stmt.Body.Lbrace
+		case *ast.ForStmt:
+			end = stmt.Body.Lbrace
+		case *ast.RangeStmt:
+			end = stmt.Body.Lbrace
+		case *ast.SwitchStmt:
+			end = stmt.Body.Lbrace
+		case *ast.TypeSwitchStmt:
+			end = stmt.Body.Lbrace
+		case *ast.SelectStmt:
+			end = stmt.Body.Lbrace
+		default:
+			return true
+		}
+
+		span := lineSpan{Start: fset.Position(node.Pos()).Line, End: fset.Position(end).Line}
+		if span.Start == span.End {
+			return true
+		}
+
+		// The lines strictly inside the bodies of the function literals
+		// are left to their own statements, visited later.
+		var bodies []lineSpan
+
+		ast.Inspect(node, func(inner ast.Node) bool {
+			if lit, ok := inner.(*ast.FuncLit); ok {
+				bodies = append(bodies, lineSpan{
+					Start: fset.Position(lit.Body.Lbrace).Line,
+					End:   fset.Position(lit.Body.Rbrace).Line,
+				})
+
+				return false
+			}
+
+			return true
+		})
+
+		for line := span.Start; line <= span.End; line++ {
+			inBody := slices.ContainsFunc(bodies, func(body lineSpan) bool {
+				return line > body.Start && line < body.End
+			})
+
+			if !inBody {
+				spans[line] = span
+			}
+		}
+
+		return true
+	})
+
+	return spans, err
+}
+
+// funcDeclNames maps the first line of every function declaration in the file
+// to the name of the function, as the compiler prints it in the inlining
+// messages, e.g. "add", "T.Len" or "(*T).Reset".
+func funcDeclNames(filePath string, src []byte) (map[int]string, error) {
+	fset := token.NewFileSet()
+
+	file, err := parser.ParseFile(fset, filePath, src, parser.SkipObjectResolution)
+	if file == nil {
+		return nil, err
+	}
+
+	names := make(map[int]string)
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+
+		name := fn.Name.Name
+
+		if fn.Recv != nil && len(fn.Recv.List) == 1 {
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				name = "(*" + receiverTypeName(star.X) + ")." + name
+			} else {
+				name = receiverTypeName(recv) + "." + name
+			}
+		}
+
+		names[fset.Position(fn.Pos()).Line] = name
+	}
+
+	return names, err
+}
+
+// receiverTypeName returns the name of the receiver type, without the type
+// parameters of a generic one.
+func receiverTypeName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.IndexExpr:
+		return receiverTypeName(e.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(e.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(e.X)
+	}
+
+	return ""
+}
+
+// fieldRef identifies a field of a named struct type within a package.
+type fieldRef struct {
+	Type  string
+	Field string
+}
+
+// structFieldLines maps the lines of the field declarations of the named struct
+// types in the file to the fields declared there.
+func structFieldLines(fset *token.FileSet, file *ast.File) map[int][]fieldRef {
+	lines := make(map[int][]fieldRef)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+
+		structType, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return true
+		}
+
+		for _, field := range structType.Fields.List {
+			line := fset.Position(field.Pos()).Line
+
+			// An embedded field is named after its type.
+			if len(field.Names) == 0 {
+				lines[line] = append(lines[line], fieldRef{Type: spec.Name.Name, Field: typeName(field.Type)})
+			}
+
+			for _, name := range field.Names {
+				lines[line] = append(lines[line], fieldRef{Type: spec.Name.Name, Field: name.Name})
+			}
+		}
+
+		return true
+	})
+
+	return lines
+}
+
+// fieldAddressSites finds the variables whose field address is taken, such as
+// "p" in "&p.x", and returns their declarations for every field. The compiler
+// does not report anything at the field itself, but at the declaration of the
+// variable holding the struct. The types are resolved syntactically, so only
+// the variables declared with an explicit struct type or literal are found.
+func fieldAddressSites(fset *token.FileSet, files []*ast.File) map[fieldRef][]Position {
+	type variable struct {
+		typeName string
+		pos      token.Pos
+	}
+
+	sites := make(map[fieldRef][]Position)
+
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+
+			vars := make(map[string]variable)
+			declare := func(ident *ast.Ident, typeName string) {
+				if typeName != "" && ident.Name != "_" {
+					vars[ident.Name] = variable{typeName: typeName, pos: ident.Pos()}
+				}
+			}
+
+			for _, fields := range []*ast.FieldList{fn.Recv, fn.Type.Params} {
+				if fields == nil {
+					continue
+				}
+
+				for _, field := range fields.List {
+					for _, name := range field.Names {
+						declare(name, typeName(field.Type))
+					}
+				}
+			}
+
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				switch n := node.(type) {
+				case *ast.AssignStmt:
+					if n.Tok != token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+						break
+					}
+
+					for i, lhs := range n.Lhs {
+						if ident, ok := lhs.(*ast.Ident); ok {
+							declare(ident, valueTypeName(n.Rhs[i]))
+						}
+					}
+				case *ast.ValueSpec:
+					for i, ident := range n.Names {
+						if n.Type != nil {
+							declare(ident, typeName(n.Type))
+						} else if i < len(n.Values) {
+							declare(ident, valueTypeName(n.Values[i]))
+						}
+					}
+				case *ast.UnaryExpr:
+					if n.Op != token.AND {
+						break
+					}
+
+					selector, ok := n.X.(*ast.SelectorExpr)
+					if !ok {
+						break
+					}
+
+					ident, ok := selector.X.(*ast.Ident)
+					if !ok {
+						break
+					}
+
+					if v, ok := vars[ident.Name]; ok {
+						ref := fieldRef{Type: v.typeName, Field: selector.Sel.Name}
+						p := fset.Position(v.pos)
+						site := Position{File: normalizePath(p.Filename), Line: p.Line}
+
+						if !slices.Contains(sites[ref], site) {
+							sites[ref] = append(sites[ref], site)
+						}
+					}
+				}
+
+				return true
+			})
+		}
+	}
+
+	return sites
+}
+
+// typeName returns the name of a named type, possibly behind a pointer.
+func typeName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return typeName(e.X)
+	}
+
+	return ""
+}
+
+// valueTypeName returns the name of the type of a struct literal, a pointer to
+// it, or a new value, and an empty string for any other expression.
+func valueTypeName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.CompositeLit:
+		return typeName(e.Type)
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			return valueTypeName(e.X)
+		}
+	case *ast.CallExpr:
+		if ident, ok := e.Fun.(*ast.Ident); ok && ident.Name == "new" && len(e.Args) == 1 {
+			return typeName(e.Args[0])
+		}
+	}
+
+	return ""
+}
+
+// parsePackageFiles parses the Go files in the directory accepted by the filter,
+// such as the ones compiled for the build tags.
+func parsePackageFiles(dir string, include func(path string) (bool, error)) (*token.FileSet, []*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+
+	var files []*ast.File
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(path, ".go") {
+			continue
+		}
+
+		included, err := include(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !included {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return fset, files, nil
+}
+
+// isGenerated reports whether the file has the "// Code generated ... DO NOT EDIT."
+// comment before its package clause, following https://go.dev/s/generatedcode.
+func isGenerated(filePath string, src []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), filePath, src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+
+	return ast.IsGenerated(file)
+}
@@ -0,0 +1,20 @@
+package main
+
+type point struct{ x, y int }
+
+var sink any
+
+func newPoint() *point {
+	x := point{1, 2} //no-escape:x
+	return &x
+}
+
+func box() {
+	var buf [16]byte //no-escape:buf
+	sink = &buf
+}
+
+func main() {
+	_ = newPoint()
+	box()
+}
@@ -0,0 +1,20 @@
+package main
+
+type point struct{ x, y int }
+
+var sink any
+
+func newPoint() *point {
+	x := point{1, 2}
+	return &x //no-escape:x
+}
+
+func box() {
+	var buf [16]byte
+	sink = &buf //no-escape:buf
+}
+
+func main() {
+	_ = newPoint()
+	box()
+}
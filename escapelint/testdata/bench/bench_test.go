@@ -0,0 +1,18 @@
+package bench
+
+import "testing"
+
+var sink *point
+
+func BenchmarkSum(b *testing.B) {
+	values := make([]int, 64) //no-escape
+	for i := 0; i < b.N; i++ {
+		_ = sum(values)
+	}
+}
+
+func BenchmarkNewPoint(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink = newPoint(i, i) //no-escape
+	}
+}
@@ -0,0 +1,16 @@
+package bench
+
+type point struct{ x, y int }
+
+func sum(values []int) int { //must-inline
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func newPoint(x, y int) *point {
+	p := point{x: x, y: y} //no-escape
+	return &p
+}
@@ -0,0 +1,33 @@
+package main
+
+type Builder struct {
+	parts []string
+}
+
+//go:noinline
+func (b *Builder) With(part string) *Builder {
+	b.parts = append(b.parts, part)
+	return b
+}
+
+var sink *Builder
+
+var global = (&Builder{}).
+	With("a").
+	With("b") //no-escape
+
+func main() {
+	b := (&Builder{}).
+		With("x").
+		With("y") //no-escape
+	sink = b
+
+	local := (&Builder{}).
+		With("x") //no-escape
+	_ = local
+
+	for _, part := range (&Builder{}).
+		With("z").parts { //no-escape
+		_ = part
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+var handlers []func() int
+
+func apply(f func() int) int {
+	return f()
+}
+
+func main() {
+	x := 1
+	y := 2
+	_ = apply(func() int { return x + 1 })                   //no-escape
+	handlers = append(handlers, func() int { return y * 2 }) //no-escape
+}
@@ -0,0 +1,17 @@
+package main
+
+func add(a, b int) int {
+	return a + b
+}
+
+func leak() *int {
+	x := 42 //no-escape
+	return &x
+}
+
+func main() {
+	buf := make([]byte, 64) //no-escape
+	_ = add(1, 2)           //must-inline
+	_ = leak()
+	_ = buf
+}
@@ -0,0 +1,26 @@
+package main
+
+var sink *int
+
+type point struct {
+	x int //no-escape
+	y int //no-escape
+}
+
+//go:noinline
+func leakX() {
+	p := point{}
+	sink = &p.x
+}
+
+//go:noinline
+func keepY() int {
+	p := point{}
+	q := &p.y
+	return *q
+}
+
+func main() {
+	leakX()
+	_ = keepY()
+}
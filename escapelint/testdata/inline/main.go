@@ -0,0 +1,31 @@
+package main
+
+type counter struct{ n int }
+
+func (c *counter) inc() { //must-inline
+	c.n++
+}
+
+func add(a, b int) int { return a + b } //must-inline
+
+func sum(values ...int) int { //must-inline
+	total := 0
+	for _, v := range values {
+		total = add(total, v)
+	}
+	defer func() {}()
+	return total
+}
+
+func main() {
+	c := &counter{}
+	c.inc()
+	c.inc()
+	_ = add(1, 2)
+	_ = add(3, 4)
+	_ = sum(5, 6)
+}
+
+func unused(a int) int { return a * 2 } //must-inline
+
+func unusedStrict(a int) int { return a * 3 } //always-inlined
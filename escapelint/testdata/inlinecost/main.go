@@ -0,0 +1,24 @@
+package main
+
+func checksum(data []byte) uint32 { //must-inline
+	var a, b uint32 = 1, 0
+	for _, c := range data {
+		a = (a + uint32(c)) % 65521
+		b = (b + a) % 65521
+	}
+	for i := 0; i+1 < len(data); i += 2 {
+		a ^= uint32(data[i]) << 8
+		b ^= uint32(data[i+1])
+	}
+	if len(data) > 1024 {
+		a, b = b, a
+	}
+	for i := len(data) - 1; i >= 0; i-- {
+		b += uint32(data[i]) * 31
+	}
+	return b<<16 | a
+}
+
+func main() {
+	_ = checksum([]byte("hello")) //must-inline:checksum
+}
@@ -0,0 +1,33 @@
+package main
+
+type point struct{ x, y int }
+
+var sink *point
+
+func newPoint(x, y int) *point {
+	p := point{x: x, y: y} //no-heap-escape
+	return &p
+}
+
+func identity(p *point) *point { //no-escape:p
+	return p
+}
+
+func store(p *point) { //no-escape:p
+	sink = p
+}
+
+func sum(values []int) int { //must-inline
+	total := 0
+	for i := range values {
+		total += values[i]
+	}
+	return total
+}
+
+func main() {
+	a := newPoint(1, 2)
+	store(identity(a))
+	buf := make([]byte, 16) //no-escape
+	_ = sum([]int{len(buf)})
+}
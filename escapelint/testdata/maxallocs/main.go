@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+var sink []*int
+
+func under(n int) { //max-allocs=3
+	x := n
+	sink = append(sink, &x)
+}
+
+func equal(a, b int) { //max-allocs=3
+	x, y := a, b
+	sink = append(sink, &x, &y)
+}
+
+func over(a, b int) { //max-allocs=3
+	x, y := a, b
+	sink = append(sink, &x, &y)
+	fmt.Println(len(sink))
+}
+
+func main() {
+	under(1)
+	equal(1, 2)
+	over(1, 2)
+}
@@ -0,0 +1,24 @@
+package main
+
+type counter struct{ n int }
+
+var last *counter
+
+func (c *counter) inc() { //no-escape:c
+	c.n++
+}
+
+func (c *counter) remember() { //no-escape:c
+	last = c
+}
+
+func (c *counter) self() *counter { //no-escape:c
+	return c
+}
+
+func main() {
+	c := &counter{}
+	c.inc()
+	c.remember()
+	_ = c.self()
+}
@@ -0,0 +1,28 @@
+package main
+
+var sink *int
+
+func sum(values []int) int {
+	before := 0
+	sink = &before
+
+	total := 0
+
+	//no-escape-begin: hot loop
+	for _, v := range values {
+		total += v
+	}
+
+	last := 0
+	sink = &last
+	//no-escape-end
+
+	after := 0
+	sink = &after
+
+	return total
+}
+
+func main() {
+	_ = sum([]int{1, 2, 3})
+}
@@ -0,0 +1,18 @@
+package main
+
+func fixed() int {
+	buf := make([]byte, 64) //stack-alloc: fixed-size scratch buffer
+	buf[0] = 1
+	return int(buf[0])
+}
+
+func sized(n int) int {
+	buf := make([]byte, n) //stack-alloc
+	buf[0] = 1
+	return int(buf[0])
+}
+
+func main() {
+	_ = fixed()
+	_ = sized(16)
+}
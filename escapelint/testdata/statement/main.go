@@ -0,0 +1,30 @@
+package main
+
+type point struct{ x, y int }
+
+var sink *point
+
+//go:noinline
+func keep(p *point, n int) *point {
+	sink = p
+	return p
+}
+
+func main() {
+	keep(&point{
+		x: 1, //no-escape
+		y: 2,
+	}, 3)
+
+	local := keep(
+		nil,
+		len([]int{1, 2}), //no-escape
+	)
+	_ = local
+
+	f := func() {
+		q := point{x: 3} //no-escape
+		_ = q
+	}
+	f()
+}
@@ -0,0 +1,6 @@
+package main
+
+func main() {
+	x := 42 //no-escape
+	_ = sum([]int{x})
+}
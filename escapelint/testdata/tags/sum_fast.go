@@ -0,0 +1,10 @@
+//go:build !purego
+
+package main
+
+func sum(values []int) (total int) { //no-escape-func
+	for i := range values {
+		total += values[i] //no-bounds-check
+	}
+	return total
+}
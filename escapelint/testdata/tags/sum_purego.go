@@ -0,0 +1,11 @@
+//go:build purego
+
+package main
+
+func sum(values []int) int {
+	total := 0 //no-escape
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+// parsePosition parses a "file:line" position given on the command line. The
+// file is made absolute, like the paths in the positions found by the parsers.
+func parsePosition(value string) (escapelint.Position, error) {
+	i := strings.LastIndex(value, ":")
+	if i == -1 {
+		return escapelint.Position{}, fmt.Errorf("invalid position %q, expected file:line", value)
+	}
+
+	line, err := strconv.Atoi(value[i+1:])
+	if err != nil || line < 1 {
+		return escapelint.Position{}, fmt.Errorf("invalid line number in position %q", value)
+	}
+
+	file, err := filepath.Abs(value[:i])
+	if err != nil {
+		return escapelint.Position{}, fmt.Errorf("invalid file in position %q: %w", value, err)
+	}
+
+	return escapelint.Position{File: file, Line: line}, nil
+}
+
+// explain prints everything known about the position given with -explain and
+// returns the exit code.
+func explain(opts Options) int {
+	hints, err := readHints(opts)
+	if err != nil {
+		log.Printf("error reading compiler output: %s", err)
+		return exitInvalid
+	}
+
+	annotations, _, err := parsePackages(opts, opts.annotationOptions())
+	if err != nil {
+		log.Printf("error parsing source code: %s", err)
+		return exitInvalid
+	}
+
+	err = writeExplanation(os.Stdout, opts.explainPos, hints, annotations, opts.compareOptions())
+
+	if err != nil {
+		log.Printf("error writing explanation: %s", err)
+		return exitInvalid
+	}
+
+	return exitOK
+}
+
+// writeExplanation writes the annotations and the compiler hints at the position,
+// and the findings produced by checking only the annotations there. All hints
+// are still considered, since some annotations look at the neighboring lines or
+// at the calls of a function elsewhere.
+func writeExplanation(
+	w io.Writer,
+	pos escapelint.Position,
+	hints map[escapelint.Position][]escapelint.Hint,
+	annotations map[escapelint.Position][]escapelint.Annotation,
+	opts escapelint.CompareOptions,
+) error {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s:%d\n\nannotations:\n", workingDirPath(pos.File), pos.Line)
+
+	if len(annotations[pos]) == 0 {
+		out.WriteString("  no annotations found at this position\n")
+	}
+
+	for _, ann := range annotations[pos] {
+		fmt.Fprintf(&out, "  %s\n", ann)
+	}
+
+	out.WriteString("\ncompiler hints:\n")
+
+	if len(hints[pos]) == 0 {
+		out.WriteString("  no hints found at this position\n")
+	}
+
+	for _, hint := range hints[pos] {
+		if hint.Symbol != "" {
+			fmt.Fprintf(&out, "  %s: %s\n", hint.Kind, hint.Symbol)
+		} else {
+			fmt.Fprintf(&out, "  %s\n", hint.Kind)
+		}
+
+		// The line as the compiler wrote it shows what the hint was parsed
+		// from, in case it has been misread.
+		if hint.Raw != "" {
+			fmt.Fprintf(&out, "    %s\n", hint.Raw)
+		}
+	}
+
+	out.WriteString("\nverdict:\n")
+
+	report := escapelint.CompareResults(hints, map[escapelint.Position][]escapelint.Annotation{
+		pos: annotations[pos],
+	}, opts)
+
+	switch {
+	case len(annotations[pos]) == 0:
+		out.WriteString("  nothing to check\n")
+	case len(report.Uninstrumented) > 0:
+		out.WriteString("  not checked, the package has no compiler hints at all\n")
+	case report.Skipped > 0:
+		out.WriteString("  not checked, the package is not one of -instrumented\n")
+	case len(report.Findings) == 0:
+		out.WriteString("  ok, all annotations are satisfied\n")
+	}
+
+	for _, finding := range report.Findings {
+		finding.Position.File = workingDirPath(finding.Position.File)
+		fmt.Fprintf(&out, "  %s: %s\n", finding.Severity, finding)
+	}
+
+	_, err := io.WriteString(w, out.String())
+
+	return err
+}
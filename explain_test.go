@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+func TestParsePosition(t *testing.T) {
+	pos, err := parsePosition("main.go:42")
+	if err != nil {
+		t.Fatalf("parsePosition failed: %v", err)
+	}
+
+	if abs, _ := filepath.Abs("main.go"); pos.File != abs || pos.Line != 42 {
+		t.Errorf("expected %s:42, got %v", abs, pos)
+	}
+
+	for _, value := range []string{"main.go", "main.go:x", "main.go:0"} {
+		if _, err := parsePosition(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestWriteExplanation(t *testing.T) {
+	pos, err := parsePosition("main.go:10")
+	if err != nil {
+		t.Fatalf("parsePosition failed: %v", err)
+	}
+
+	other := escapelint.Position{File: pos.File, Line: 20}
+
+	hints := map[escapelint.Position][]escapelint.Hint{
+		pos:   {{Kind: escapelint.MovedToHeap, Symbol: "buf", Raw: "./main.go:10:2: moved to heap: buf"}},
+		other: {{Kind: escapelint.FoundIsInBounds}},
+	}
+
+	annotations := map[escapelint.Position][]escapelint.Annotation{
+		pos:   {{Kind: escapelint.NoEscape, Reason: "hot path"}},
+		other: {{Kind: escapelint.NoBoundsCheck}},
+	}
+
+	tests := []struct {
+		name     string
+		pos      escapelint.Position
+		expected string
+	}{
+		{
+			name: "violation",
+			pos:  pos,
+			expected: `main.go:10
+
+annotations:
+  no-escape (hot path)
+
+compiler hints:
+  moved-to-heap: buf
+    ./main.go:10:2: moved to heap: buf
+
+verdict:
+  error: variable at main.go:10 is marked as no-escape (hot path) but escapes to heap
+`,
+		},
+		{
+			name: "no hints",
+			pos:  escapelint.Position{File: pos.File, Line: 30},
+			expected: `main.go:30
+
+annotations:
+  no annotations found at this position
+
+compiler hints:
+  no hints found at this position
+
+verdict:
+  nothing to check
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			if err := writeExplanation(&buf, tt.pos, hints, annotations, escapelint.CompareOptions{}); err != nil {
+				t.Fatalf("writeExplanation failed: %v", err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
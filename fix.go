@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+const fixRemoveStale = "remove-stale"
+
+// fixers produce the source code edits selected with -fix.
+var fixers = map[string]func(report escapelint.Report) ([]escapelint.LineFix, error){
+	fixRemoveStale: escapelint.StaleFixes,
+}
+
+// runFix rewrites the source files and writes the applied changes as a unified diff.
+func runFix(w io.Writer, mode string, report escapelint.Report) error {
+	fixes, err := fixers[mode](report)
+	if err != nil {
+		return err
+	}
+
+	if err := escapelint.ApplyFixes(fixes); err != nil {
+		return err
+	}
+
+	return writeDiff(w, fixes)
+}
+
+// writeDiff writes the fixes as a unified diff. The fixes never add or remove
+// lines, so each of them becomes a hunk of its own.
+func writeDiff(w io.Writer, fixes []escapelint.LineFix) error {
+	currentFile := ""
+
+	for _, fix := range fixes {
+		if fix.Position.File != currentFile {
+			currentFile = fix.Position.File
+			name := filepath.ToSlash(workingDirPath(currentFile))
+
+			if _, err := fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", name, name); err != nil {
+				return err
+			}
+		}
+
+		_, err := fmt.Fprintf(w, "@@ -%d +%d @@\n-%s\n+%s\n", fix.Position.Line, fix.Position.Line, fix.Before, fix.After)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
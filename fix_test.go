@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+func TestWriteDiff(t *testing.T) {
+	fixes := []escapelint.LineFix{
+		{Position: escapelint.Position{File: "main.go", Line: 4}, Before: "\tx := 42 //no-escape", After: "\tx := 42"},
+		{Position: escapelint.Position{File: "main.go", Line: 9}, Before: "\tfoo() //must-inline", After: "\tfoo()"},
+		{Position: escapelint.Position{File: "other.go", Line: 3}, Before: "var y = 1 //no-escape", After: "var y = 1"},
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeDiff(&buf, fixes); err != nil {
+		t.Fatalf("writeDiff failed: %v", err)
+	}
+
+	expected := `--- a/main.go
++++ b/main.go
+@@ -4 +4 @@
+-	x := 42 //no-escape
++	x := 42
+@@ -9 +9 @@
+-	foo() //must-inline
++	foo()
+--- a/other.go
++++ b/other.go
+@@ -3 +3 @@
+-var y = 1 //no-escape
++var y = 1
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
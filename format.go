@@ -0,0 +1,459 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+// formatters write the report in one of the output formats selected with -format.
+// The options tell how much of it to write and how, e.g. -max-findings and -color.
+var formatters = map[string]func(w io.Writer, report escapelint.Report, opts Options) error{
+	"text":       writeText,
+	"json":       writeJSON,
+	"github":     writeGitHub,
+	"checkstyle": writeCheckstyle,
+	"quickfix":   writeQuickfix,
+}
+
+// shownFindings returns the findings to print and the number of the omitted ones.
+// The text and github formats end up in CI logs, so they print at most the limit
+// of -max-findings, or all of them if zero. It only affects the output, the
+// summary and the exit code account for all findings.
+func shownFindings(findings []escapelint.Finding, limit int) ([]escapelint.Finding, int) {
+	if limit <= 0 || len(findings) <= limit {
+		return findings, 0
+	}
+
+	return findings[:limit], len(findings) - limit
+}
+
+// pathModes lists the accepted values of -path-mode. The empty one prints the
+// paths within the working directory relative to it, and the others absolute.
+var pathModes = []string{"", "abs", "rel"}
+
+// workingDirPath returns the path relative to the working directory if the file
+// is inside of it, or the path as it is otherwise. The positions hold absolute
+// paths, which are too long to read for the files at hand.
+func workingDirPath(file string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return file
+	}
+
+	if relFile, err := filepath.Rel(wd, file); err == nil && filepath.IsLocal(relFile) {
+		return relFile
+	}
+
+	return file
+}
+
+// rewritePaths returns a copy of the report with the file paths made absolute,
+// relative to the base directory, or by default relative to the working
+// directory if possible. Paths that cannot be made relative, e.g. on
+// another drive, are left absolute.
+func rewritePaths(report escapelint.Report, mode, baseDir string) escapelint.Report {
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return report
+	}
+
+	report.Findings = slices.Clone(report.Findings)
+
+	for i := range report.Findings {
+		file := report.Findings[i].Position.File
+
+		absFile, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+
+		file = absFile
+
+		switch mode {
+		case "":
+			file = workingDirPath(absFile)
+		case "rel":
+			if relFile, err := filepath.Rel(absBase, absFile); err == nil {
+				file = relFile
+			}
+		}
+
+		report.Findings[i].Position.File = file
+	}
+
+	return report
+}
+
+// writeList writes the annotations sorted by position, one per line.
+func writeList(w io.Writer, annotations map[escapelint.Position][]escapelint.Annotation) error {
+	positions := make([]escapelint.Position, 0, len(annotations))
+	for pos := range annotations {
+		positions = append(positions, pos)
+	}
+
+	slices.SortFunc(positions, func(a, b escapelint.Position) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+
+	for _, pos := range positions {
+		for _, ann := range annotations[pos] {
+			if _, err := fmt.Fprintf(w, "%s:%d: %s\n", workingDirPath(pos.File), pos.Line, ann); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeReportFile writes the report in the format of the options to a file,
+// creating the parent directories if needed.
+func writeReportFile(filePath string, report escapelint.Report, opts Options) (err error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return formatters[opts.Format](file, report, opts)
+}
+
+// writeText writes the human-readable report, followed by the summary.
+func writeText(w io.Writer, report escapelint.Report, opts Options) error {
+	findings, omitted := shownFindings(report.Findings, opts.MaxFindings)
+
+	for _, finding := range findings {
+		line := opts.colorize(finding.String(), ansiRed)
+		if finding.Severity == escapelint.SeverityWarning {
+			line = opts.colorize("warning: "+finding.String(), ansiYellow)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s\n", logPrefix, line); err != nil {
+			return err
+		}
+
+		if finding.Snippet != "" {
+			if _, err := fmt.Fprintf(w, "%s    %s\n", logPrefix, finding.Snippet); err != nil {
+				return err
+			}
+		}
+	}
+
+	if omitted > 0 {
+		if _, err := fmt.Fprintf(w, "%s... and %d more\n", logPrefix, omitted); err != nil {
+			return err
+		}
+	}
+
+	summaryColor := ansiGreen
+	if !report.Valid() {
+		summaryColor = ansiRed
+	}
+
+	_, err := fmt.Fprintf(w, "%s%s\n", logPrefix, opts.colorize(report.Summary(), summaryColor))
+
+	return err
+}
+
+// writeRedundant writes how many annotations of each kind matched no compiler
+// hints. A kind that never matches is likely misconfigured rather than stale.
+func writeRedundant(w io.Writer, report escapelint.Report, opts Options) error {
+	for _, kind := range sortedKinds(report) {
+		stats := report.Kinds[kind]
+
+		var message string
+
+		switch {
+		case stats.Unmatched == 0:
+			continue
+		case stats.Unmatched == stats.Checked:
+			message = fmt.Sprintf("%s annotations: none of %d matched any compiler hints; is the compiler output produced with the right flags?",
+				kind, stats.Checked)
+		default:
+			message = fmt.Sprintf("%s annotations: %d of %d matched no compiler hints and are likely redundant",
+				kind, stats.Unmatched, stats.Checked)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s\n", logPrefix, opts.colorize("warning: "+message, ansiYellow)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeMachineSummary writes a single line with the counts of the report in a
+// stable format, for the scripts that only need to grep the outcome of a run.
+func writeMachineSummary(w io.Writer, report escapelint.Report) error {
+	failures := report.Errors()
+
+	_, err := fmt.Fprintf(w, "ESCAPE_LINT_RESULT failures=%d warnings=%d checked=%d\n",
+		failures, len(report.Findings)-failures, report.Checked)
+
+	return err
+}
+
+// sortedKinds returns the kinds of the annotations checked in the report.
+func sortedKinds(report escapelint.Report) []escapelint.AnnotationKind {
+	kinds := make([]escapelint.AnnotationKind, 0, len(report.Kinds))
+	for kind := range report.Kinds {
+		kinds = append(kinds, kind)
+	}
+
+	slices.Sort(kinds)
+
+	return kinds
+}
+
+// writeStats writes a table with the number of annotations of each kind by
+// verdict, followed by the totals.
+func writeStats(w io.Writer, report escapelint.Report) error {
+	kinds := sortedKinds(report)
+
+	width := len("annotation")
+	for _, kind := range kinds {
+		width = max(width, len(kind))
+	}
+
+	row := func(name string, checked, passed, failed, allowed, stale any) error {
+		_, err := fmt.Fprintf(w, "%s%-*s  %7v  %6v  %6v  %7v  %5v\n",
+			logPrefix, width, name, checked, passed, failed, allowed, stale)
+		return err
+	}
+
+	if err := row("annotation", "checked", "passed", "failed", "allowed", "stale"); err != nil {
+		return err
+	}
+
+	var total escapelint.KindStats
+
+	for _, kind := range kinds {
+		stats := report.Kinds[kind]
+
+		if err := row(string(kind), stats.Checked, stats.Passed, stats.Failed, stats.Allowed, stats.Stale); err != nil {
+			return err
+		}
+
+		total.Checked += stats.Checked
+		total.Passed += stats.Passed
+		total.Failed += stats.Failed
+		total.Allowed += stats.Allowed
+		total.Stale += stats.Stale
+	}
+
+	return row("total", total.Checked, total.Passed, total.Failed, total.Allowed, total.Stale)
+}
+
+type jsonFinding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Annotation string `json:"annotation"`
+	Reason     string `json:"reason,omitempty"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Snippet    string `json:"snippet,omitempty"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Distance   int    `json:"distance,omitempty"`
+	Column     int    `json:"column,omitempty"`
+}
+
+type jsonKindStats struct {
+	Checked   int `json:"checked"`
+	Passed    int `json:"passed"`
+	Failed    int `json:"failed"`
+	Allowed   int `json:"allowed"`
+	Stale     int `json:"stale"`
+	Unmatched int `json:"unmatched"`
+}
+
+type jsonReport struct {
+	Findings  []jsonFinding            `json:"findings"`
+	Checked   int                      `json:"checked"`
+	Unmatched int                      `json:"unmatched"`
+	Allowed   int                      `json:"allowed,omitempty"`
+	Skipped   int                      `json:"skipped,omitempty"`
+	Stats     map[string]jsonKindStats `json:"stats,omitempty"`
+}
+
+// newJSONReport converts the report to the document written by writeJSON. With
+// stats, the number of annotations of each kind by verdict is added, which the
+// other formats print as a separate table with writeStats.
+func newJSONReport(report escapelint.Report, stats bool) jsonReport {
+	out := jsonReport{
+		Findings:  make([]jsonFinding, 0, len(report.Findings)),
+		Checked:   report.Checked,
+		Unmatched: report.Unmatched,
+		Allowed:   report.Allowed,
+		Skipped:   report.Skipped,
+	}
+
+	for _, finding := range report.Findings {
+		out.Findings = append(out.Findings, jsonFinding{
+			File:       finding.Position.File,
+			Line:       finding.Position.Line,
+			Annotation: string(finding.Annotation.Kind),
+			Reason:     finding.Annotation.Reason,
+			Severity:   string(finding.Severity),
+			Message:    finding.Subject + " " + finding.Message,
+			Snippet:    finding.Snippet,
+			Suggestion: finding.Suggestion,
+			Distance:   finding.Distance,
+			Column:     finding.Column,
+		})
+	}
+
+	if stats {
+		out.Stats = make(map[string]jsonKindStats, len(report.Kinds))
+
+		for kind, stats := range report.Kinds {
+			out.Stats[string(kind)] = jsonKindStats{
+				Checked:   stats.Checked,
+				Passed:    stats.Passed,
+				Failed:    stats.Failed,
+				Allowed:   stats.Allowed,
+				Stale:     stats.Stale,
+				Unmatched: stats.Unmatched,
+			}
+		}
+	}
+
+	return out
+}
+
+// writeJSON writes the report as a single JSON document. The summary is
+// omitted, since it can be derived from the document itself.
+func writeJSON(w io.Writer, report escapelint.Report, opts Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(newJSONReport(report, opts.Stats))
+}
+
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// writeGitHub writes the findings as GitHub Actions workflow commands, which are
+// shown as annotations on the lines of a pull request.
+func writeGitHub(w io.Writer, report escapelint.Report, opts Options) error {
+	findings, omitted := shownFindings(report.Findings, opts.MaxFindings)
+
+	for _, finding := range findings {
+		command := "error"
+		if finding.Severity == escapelint.SeverityWarning {
+			command = "warning"
+		}
+
+		_, err := fmt.Fprintf(w, "::%s file=%s,line=%d::%s\n",
+			command,
+			githubPropertyEscaper.Replace(filepath.ToSlash(finding.Position.File)),
+			finding.Position.Line,
+			githubDataEscaper.Replace(finding.Subject+" "+finding.Message),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if omitted > 0 {
+		if _, err := fmt.Fprintf(w, "::notice::... and %d more\n", omitted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeQuickfix writes the findings as "file:line:col: severity: message" lines,
+// the format of compilers that editors such as vim read into their error list.
+// The findings without a column point at the start of the line, since the
+// column is required to jump there.
+func writeQuickfix(w io.Writer, report escapelint.Report, _ Options) error {
+	for _, finding := range report.Findings {
+		_, err := fmt.Fprintf(w, "%s:%d:%d: %s: %s %s\n",
+			finding.Position.File,
+			finding.Position.Line,
+			max(finding.Column, 1),
+			finding.Severity,
+			finding.Subject,
+			finding.Message,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+// writeCheckstyle writes the findings as a Checkstyle XML document, grouped by
+// file. The source of each error is the annotation that is not satisfied.
+func writeCheckstyle(w io.Writer, report escapelint.Report, _ Options) error {
+	out := checkstyleReport{Version: "4.3"}
+
+	for _, finding := range report.Findings {
+		if len(out.Files) == 0 || out.Files[len(out.Files)-1].Name != finding.Position.File {
+			out.Files = append(out.Files, checkstyleFile{Name: finding.Position.File})
+		}
+
+		file := &out.Files[len(out.Files)-1]
+		file.Errors = append(file.Errors, checkstyleError{
+			Line:     finding.Position.Line,
+			Severity: string(finding.Severity),
+			Message:  finding.Subject + " " + finding.Message,
+			Source:   "go-escape-lint." + string(finding.Annotation.Kind),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+var testReport = escapelint.Report{
+	Findings: []escapelint.Finding{
+		{
+			Position:   escapelint.Position{File: "main.go", Line: 10},
+			Annotation: escapelint.Annotation{Kind: escapelint.NoEscape, Reason: "hot path"},
+			Severity:   escapelint.SeverityError,
+			Subject:    "variable",
+			Message:    "is marked as no-escape (hot path) but escapes to heap",
+			Snippet:    "x := 42 //no-escape: hot path",
+		},
+		{
+			Position:   escapelint.Position{File: "main.go", Line: 20},
+			Annotation: escapelint.Annotation{Kind: escapelint.MustInline},
+			Severity:   escapelint.SeverityWarning,
+			Subject:    "annotation",
+			Message:    "matched no compiler output; is it stale?",
+		},
+	},
+	Checked:   3,
+	Unmatched: 1,
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeText(&buf, testReport, Options{}); err != nil {
+		t.Fatalf("writeText failed: %v", err)
+	}
+
+	expected := `go-escape-lint: variable at main.go:10 is marked as no-escape (hot path) but escapes to heap
+go-escape-lint:     x := 42 //no-escape: hot path
+go-escape-lint: warning: annotation at main.go:20 matched no compiler output; is it stale?
+go-escape-lint: 1 failure across 1 file (3 annotations checked, 1 matched no compiler hints)
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteMaxFindings(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeText(&buf, testReport, Options{MaxFindings: 1}); err != nil {
+		t.Fatalf("writeText failed: %v", err)
+	}
+
+	// The summary still counts all findings.
+	expected := `go-escape-lint: variable at main.go:10 is marked as no-escape (hot path) but escapes to heap
+go-escape-lint:     x := 42 //no-escape: hot path
+go-escape-lint: ... and 1 more
+go-escape-lint: 1 failure across 1 file (3 annotations checked, 1 matched no compiler hints)
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+
+	if err := writeGitHub(&buf, testReport, Options{MaxFindings: 1}); err != nil {
+		t.Fatalf("writeGitHub failed: %v", err)
+	}
+
+	expected = `::error file=main.go,line=10::variable is marked as no-escape (hot path) but escapes to heap
+::notice::... and 1 more
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeJSON(&buf, testReport, Options{}); err != nil {
+		t.Fatalf("writeJSON failed: %v", err)
+	}
+
+	expected := `{
+  "findings": [
+    {
+      "file": "main.go",
+      "line": 10,
+      "annotation": "no-escape",
+      "reason": "hot path",
+      "severity": "error",
+      "message": "variable is marked as no-escape (hot path) but escapes to heap",
+      "snippet": "x := 42 //no-escape: hot path"
+    },
+    {
+      "file": "main.go",
+      "line": 20,
+      "annotation": "must-inline",
+      "severity": "warning",
+      "message": "annotation matched no compiler output; is it stale?"
+    }
+  ],
+  "checked": 3,
+  "unmatched": 1
+}
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteGitHub(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeGitHub(&buf, testReport, Options{}); err != nil {
+		t.Fatalf("writeGitHub failed: %v", err)
+	}
+
+	expected := `::error file=main.go,line=10::variable is marked as no-escape (hot path) but escapes to heap
+::warning file=main.go,line=20::annotation matched no compiler output; is it stale?
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteQuickfix(t *testing.T) {
+	report := testReport
+	report.Findings = slices.Clone(report.Findings)
+	report.Findings[0].Column = 10
+
+	var buf bytes.Buffer
+
+	if err := writeQuickfix(&buf, report, Options{}); err != nil {
+		t.Fatalf("writeQuickfix failed: %v", err)
+	}
+
+	expected := `main.go:10:10: error: variable is marked as no-escape (hot path) but escapes to heap
+main.go:20:1: warning: annotation matched no compiler output; is it stale?
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteCheckstyle(t *testing.T) {
+	var buf bytes.Buffer
+
+	report := testReport
+	report.Findings = append(slices.Clone(report.Findings), escapelint.Finding{
+		Position:   escapelint.Position{File: "other.go", Line: 5},
+		Annotation: escapelint.Annotation{Kind: escapelint.NoBoundsCheck},
+		Severity:   escapelint.SeverityError,
+		Subject:    "variable",
+		Message:    "is marked as no-bounds-check but bounds check is not eliminated",
+	})
+
+	if err := writeCheckstyle(&buf, report, Options{}); err != nil {
+		t.Fatalf("writeCheckstyle failed: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="main.go">
+    <error line="10" severity="error" message="variable is marked as no-escape (hot path) but escapes to heap" source="go-escape-lint.no-escape"></error>
+    <error line="20" severity="warning" message="annotation matched no compiler output; is it stale?" source="go-escape-lint.must-inline"></error>
+  </file>
+  <file name="other.go">
+    <error line="5" severity="error" message="variable is marked as no-bounds-check but bounds check is not eliminated" source="go-escape-lint.no-bounds-check"></error>
+  </file>
+</checkstyle>
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRewritePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	report := escapelint.Report{
+		Findings: []escapelint.Finding{
+			{Position: escapelint.Position{File: filepath.Join(tmpDir, "pkg", "main.go"), Line: 10}},
+		},
+	}
+
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{mode: "", expected: filepath.Join(tmpDir, "pkg", "main.go")},
+		{mode: "abs", expected: filepath.Join(tmpDir, "pkg", "main.go")},
+		{mode: "rel", expected: filepath.Join("pkg", "main.go")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			output := rewritePaths(report, tt.mode, tmpDir)
+
+			if file := output.Findings[0].Position.File; file != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, file)
+			}
+		})
+	}
+
+	if file := report.Findings[0].Position.File; file != filepath.Join(tmpDir, "pkg", "main.go") {
+		t.Errorf("expected the original report to be unchanged, got %q", file)
+	}
+}
+
+func TestWriteList(t *testing.T) {
+	var buf bytes.Buffer
+
+	annotations := map[escapelint.Position][]escapelint.Annotation{
+		{File: "main.go", Line: 20}: {{Kind: escapelint.MustInline}},
+		{File: "b.go", Line: 3}:     {{Kind: escapelint.NoBoundsCheck, Arches: []string{"amd64"}}},
+		{File: "main.go", Line: 4}:  {{Kind: escapelint.NoEscape, Reason: "hot path"}, {Kind: escapelint.NoInline}},
+	}
+
+	if err := writeList(&buf, annotations); err != nil {
+		t.Fatalf("writeList failed: %v", err)
+	}
+
+	expected := `b.go:3: no-bounds-check:amd64
+main.go:4: no-escape (hot path)
+main.go:4: no-inline
+main.go:20: must-inline
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteRedundant(t *testing.T) {
+	var buf bytes.Buffer
+
+	report := escapelint.Report{
+		Kinds: map[escapelint.AnnotationKind]escapelint.KindStats{
+			escapelint.NoEscape:      {Checked: 10, Unmatched: 3},
+			escapelint.NoBoundsCheck: {Checked: 5, Unmatched: 5},
+			escapelint.MustInline:    {Checked: 2},
+		},
+	}
+
+	if err := writeRedundant(&buf, report, Options{}); err != nil {
+		t.Fatalf("writeRedundant failed: %v", err)
+	}
+
+	expected := `go-escape-lint: warning: no-bounds-check annotations: none of 5 matched any compiler hints; is the compiler output produced with the right flags?
+go-escape-lint: warning: no-escape annotations: 3 of 10 matched no compiler hints and are likely redundant
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteMachineSummary(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeMachineSummary(&buf, testReport); err != nil {
+		t.Fatalf("writeMachineSummary failed: %v", err)
+	}
+
+	expected := "ESCAPE_LINT_RESULT failures=1 warnings=1 checked=3\n"
+
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	report := escapelint.Report{
+		Kinds: map[escapelint.AnnotationKind]escapelint.KindStats{
+			escapelint.NoEscape:   {Checked: 10, Unmatched: 2, Passed: 5, Failed: 2, Allowed: 1, Stale: 2},
+			escapelint.MustInline: {Checked: 3, Passed: 3},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeStats(&buf, report); err != nil {
+		t.Fatalf("writeStats failed: %v", err)
+	}
+
+	expected := `go-escape-lint: annotation   checked  passed  failed  allowed  stale
+go-escape-lint: must-inline        3       3       0        0      0
+go-escape-lint: no-escape         10       5       2        1      2
+go-escape-lint: total             13       8       2        1      2
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	stats := newJSONReport(report, true).Stats
+
+	expectedStats := map[string]jsonKindStats{
+		"no-escape":   {Checked: 10, Passed: 5, Failed: 2, Allowed: 1, Stale: 2, Unmatched: 2},
+		"must-inline": {Checked: 3, Passed: 3},
+	}
+
+	if !maps.Equal(stats, expectedStats) {
+		t.Errorf("expected %+v, got %+v", expectedStats, stats)
+	}
+}
+
+func TestWriteReportFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "reports", "escape", "report.json")
+
+	if err := writeReportFile(outputFile, testReport, Options{Format: "json"}); err != nil {
+		t.Fatalf("writeReportFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"checked": 3`) {
+		t.Errorf("unexpected report contents: %s", data)
+	}
+}
+
+func TestWriteReportFileError(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A regular file cannot be used as a parent directory.
+	parent := filepath.Join(tmpDir, "file")
+	if err := os.WriteFile(parent, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := writeReportFile(filepath.Join(parent, "report.json"), testReport, Options{Format: "json"}); err == nil {
+		t.Errorf("expected an error when the parent is not a directory")
+	}
+}
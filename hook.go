@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+// hookMarker identifies the hooks written by -install-hook, which are replaced
+// without -force when the hook is installed again.
+const hookMarker = "# Installed by go-escape-lint -install-hook."
+
+// hookScript is the pre-commit hook checking the annotations on the staged lines.
+// The packages with staged Go files are built from the repository root, so that
+// the paths in the compiler output match the ones in the diff.
+var hookScript = `#!/bin/sh
+` + hookMarker + `
+# Checks the escape analysis annotations on the staged lines of Go code.
+
+dirs=$(git diff --cached --name-only --diff-filter=ACMR -- '*.go' | sed -e 's|/[^/]*$||' -e t -e 's|.*|.|' | sort -u)
+if [ -z "$dirs" ]; then
+	exit 0
+fi
+
+log=$(mktemp ./.go-escape-lint.XXXXXX) || exit 1
+trap 'rm -f "$log"' EXIT
+
+echo "$dirs" | while IFS= read -r dir; do
+	if ! go build -gcflags="` + escapelint.DefaultGCFlags + `" -o /dev/null "./$dir" >>"$log" 2>&1; then
+		cat "$log" >&2
+		exit 1
+	fi
+done || exit 1
+
+git diff --cached -U0 --diff-filter=ACMR -- '*.go' | go-escape-lint -f "$log" -allow-empty -diff -
+`
+
+// installHook writes the pre-commit hook to the repository of the package.
+func installHook(opts Options) int {
+	// The hook checks the changed packages of the whole repository, so the
+	// first package is enough to find it.
+	hookPath, err := writeHook(opts.Pkg[0], opts.Force)
+	if err != nil {
+		log.Printf("error installing hook: %s", err)
+		return exitInvalid
+	}
+
+	log.Printf("installed pre-commit hook to %s", hookPath)
+
+	return exitOK
+}
+
+// writeHook writes the pre-commit hook to the hooks directory of the git
+// repository containing dir, and returns its path. An existing hook is only
+// replaced if it was installed by this tool, or if force is set.
+func writeHook(dir string, force bool) (string, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	hooksDir, err := gitHooksDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	hookPath := filepath.Join(hooksDir, "pre-commit")
+
+	existing, err := os.ReadFile(hookPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if err == nil && !force && !strings.Contains(string(existing), hookMarker) {
+		return "", fmt.Errorf("%s already exists, use -force to replace it", hookPath)
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(hookPath, []byte(hookScript), 0755); err != nil {
+		return "", err
+	}
+
+	// WriteFile keeps the permissions of an existing file.
+	if err := os.Chmod(hookPath, 0755); err != nil {
+		return "", err
+	}
+
+	return hookPath, nil
+}
+
+// gitHooksDir asks git for the hooks directory of the repository containing
+// dir, which takes core.hooksPath and worktrees into account.
+func gitHooksDir(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("not a git repository: %s: %s", dir, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return "", err
+	}
+
+	hooksDir := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+
+	return hooksDir, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestHookScriptSyntax(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	scriptPath := filepath.Join(t.TempDir(), "pre-commit")
+	if err := os.WriteFile(scriptPath, []byte(hookScript), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	if output, err := exec.Command("sh", "-n", scriptPath).CombinedOutput(); err != nil {
+		t.Errorf("invalid shell script: %v\n%s", err, output)
+	}
+}
+
+func TestWriteHook(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	tmpDir := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", tmpDir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, output)
+	}
+
+	hookPath := filepath.Join(tmpDir, ".git", "hooks", "pre-commit")
+
+	// Installing the hook again must not require -force.
+	for i := 0; i < 2; i++ {
+		installed, err := writeHook(tmpDir, false)
+		if err != nil {
+			t.Fatalf("writeHook failed: %v", err)
+		}
+
+		if installed != hookPath {
+			t.Errorf("expected hook at %s, got %s", hookPath, installed)
+		}
+	}
+
+	info, err := os.Stat(hookPath)
+	if err != nil {
+		t.Fatalf("hook not written: %v", err)
+	}
+
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("expected the hook to be executable, got %s", info.Mode())
+	}
+
+	if err := os.WriteFile(hookPath, []byte("#!/bin/sh\nmake lint\n"), 0755); err != nil {
+		t.Fatalf("failed to write hook: %v", err)
+	}
+
+	if _, err := writeHook(tmpDir, false); err == nil {
+		t.Errorf("expected an error for an existing hook")
+	}
+
+	if _, err := writeHook(tmpDir, true); err != nil {
+		t.Errorf("writeHook with force failed: %v", err)
+	}
+
+	if content, _ := os.ReadFile(hookPath); string(content) != hookScript {
+		t.Errorf("expected the hook to be replaced, got %q", content)
+	}
+
+	if _, err := writeHook(t.TempDir(), false); err == nil {
+		t.Errorf("expected an error outside of a git repository")
+	}
+}
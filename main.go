@@ -1,320 +1,469 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
-	"path"
-	"path/filepath"
+	"os/signal"
 	"slices"
-	"strconv"
 	"strings"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
 )
 
-type Annotation string
+const logPrefix = "go-escape-lint: "
 
+// Exit codes reported by the tool. Problems with the annotations themselves
+// take precedence over failed checks, since they make the results unreliable.
 const (
-	NoEscape      Annotation = "no-escape"
-	NoBoundsCheck Annotation = "no-bounds-check"
-	MustInline    Annotation = "must-inline"
+	exitOK      = 0
+	exitFailure = 1
+	exitInvalid = 2
 )
 
-type CompilerHint string
+// readDiff reads the lines changed in the diff, with the paths resolved relative
+// to the root directory.
+func readDiff(filePath, root string) (map[escapelint.Position]bool, error) {
+	if filePath == "-" {
+		return escapelint.ParseDiff(os.Stdin, root)
+	}
 
-const (
-	EscapesToHeap   CompilerHint = "escapes-to-heap"
-	MovedToHeap     CompilerHint = "moved-to-heap"
-	StaysOnStack    CompilerHint = "stays-on-stack"
-	FoundIsInBounds CompilerHint = "found-is-in-bounds"
-	Inlined         CompilerHint = "inlined"
-)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
 
-var knownAnnotations = []Annotation{
-	NoEscape,
-	NoBoundsCheck,
-	MustInline,
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return escapelint.ParseDiff(file, root)
 }
 
-const (
-	logPrefix            = "go-escape-lint: "
-	maxCommentLength     = 20
-	levenshteinThreshold = 3
-)
+// diffRoot returns the directory the paths in the diff are relative to: the one
+// given with -diff-root, or the root of the git repository of the first package,
+// or the working directory outside of a git repository.
+func diffRoot(opts Options) string {
+	if opts.DiffRoot != "" {
+		return opts.DiffRoot
+	}
 
-type Position struct {
-	File string
-	Line int
+	if root, err := gitRoot(opts.Pkg[0]); err == nil {
+		return root
+	}
+
+	return "."
 }
 
-func levenshteinDistance(a, b string) int {
-	if len(a) < len(b) {
-		a, b = b, a
+// anyFileExists reports whether any of the files changed in the diff exists,
+// which tells whether the paths are resolved against the right directory.
+func anyFileExists(changed map[escapelint.Position]bool) bool {
+	for pos := range changed {
+		if _, err := os.Stat(pos.File); err == nil {
+			return true
+		}
 	}
 
-	previous := make([]int, len(b)+1)
-	for i := range previous {
-		previous[i] = i
+	return false
+}
+
+func main() {
+	log.SetPrefix(logPrefix)
+	log.SetOutput(os.Stderr)
+	log.SetFlags(0)
+
+	opts, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	} else if err != nil {
+		log.Printf("error: %s", err)
+		os.Exit(exitInvalid)
 	}
 
-	for i, ra := range a {
-		current := make([]int, len(b)+1)
-		current[0] = i + 1
+	if opts.PrintConfig {
+		if err := printConfig(os.Stdout, opts); err != nil {
+			log.Printf("error: %s", err)
+			os.Exit(exitInvalid)
+		}
 
-		for j, rb := range b {
-			insertions := previous[j+1] + 1
-			deletions := current[j] + 1
-			substitutions := previous[j]
+		os.Exit(exitOK)
+	}
 
-			if ra != rb {
-				substitutions++
-			}
+	escapelint.Verbose = opts.Verbose
+	escapelint.MaxLineLength = opts.MaxLineLength
+	if opts.useColor {
+		log.SetOutput(colorLogWriter{w: os.Stderr})
+	}
 
-			current[j+1] = min(insertions, deletions, substitutions)
+	for _, rule := range opts.rules {
+		if err := escapelint.RegisterRule(rule); err != nil {
+			log.Printf("error: %s", err)
+			os.Exit(exitInvalid)
 		}
-
-		previous = current
 	}
 
-	return previous[len(b)]
-}
+	if opts.InstallHook {
+		os.Exit(installHook(opts))
+	}
 
-func ParseCompilerOutput(filePath string) (map[Position][]CompilerHint, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+	if opts.List {
+		os.Exit(list(opts))
 	}
 
-	results := make(map[Position][]CompilerHint)
-	scanner := bufio.NewScanner(file)
-	dirname := path.Dir(filePath)
-	scannerLine := 1
+	if opts.LintAnnotations {
+		os.Exit(lintAnnotations(opts))
+	}
 
-	for scanner.Scan() {
-		var annotation CompilerHint
-		line := scanner.Text()
+	if opts.Explain != "" {
+		os.Exit(explain(opts))
+	}
 
-		switch {
-		case strings.Contains(line, "escapes to heap"):
-			annotation = EscapesToHeap
-		case strings.Contains(line, "moved to heap"):
-			annotation = MovedToHeap
-		case strings.Contains(line, "stays on stack"):
-			annotation = StaysOnStack
-		case strings.Contains(line, "inlining call"):
-			annotation = Inlined
-		case strings.Contains(line, "Found IsInBounds"):
-			annotation = FoundIsInBounds
-		}
+	if opts.Watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
 
-		if annotation != "" {
-			parts := strings.Fields(line)
+		watch(ctx, opts)
 
-			if len(parts) > 0 {
-				pos := strings.Split(parts[0], ":")
+		return
+	}
 
-				if len(pos) >= 2 {
-					lineNum, err := strconv.Atoi(pos[1])
-					if err != nil {
-						return nil, fmt.Errorf("failed to parse line number at %d: %w", scannerLine, err)
-					}
+	os.Exit(run(opts))
+}
 
-					fileName := pos[0]
-					normalizedFile := path.Clean(path.Join(dirname, fileName))
-					lineKey := Position{File: normalizedFile, Line: lineNum}
-					results[lineKey] = append(results[lineKey], annotation)
-				}
+// readHints collects the compiler hints either from the compiler output files
+// or by building the packages.
+func readHints(opts Options) (map[escapelint.Position][]escapelint.Hint, error) {
+	if opts.Run {
+		hints := make(map[escapelint.Position][]escapelint.Hint)
+
+		// The packages do not overlap, so neither do their hints.
+		for _, pkg := range opts.Pkg {
+			pkgHints, err := escapelint.RunCompiler(pkg, opts.GCFlags, opts.Tags)
+			if err != nil {
+				return nil, err
 			}
+
+			maps.Copy(hints, pkgHints)
 		}
 
-		scannerLine++
+		return hints, nil
+	}
+
+	if opts.InputFormat == "json" {
+		return escapelint.ParseCompilerJSON(opts.InputFiles...)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	return escapelint.ParseCompilerOutput(opts.InputFiles...)
+}
+
+// parsePackages parses the annotations of every package given with -pkg and
+// merges them, as if they were a single one.
+func parsePackages(opts Options, annotationOpts escapelint.AnnotationOptions) (map[escapelint.Position][]escapelint.Annotation, bool, error) {
+	annotations := make(map[escapelint.Position][]escapelint.Annotation)
+	valid := true
+
+	for _, pkg := range opts.Pkg {
+		pkgAnnotations, pkgValid, err := escapelint.ParseCodeAnnotations(pkg, annotationOpts)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", pkg, err)
+		}
+
+		if !pkgValid {
+			valid = false
+		}
+
+		maps.Copy(annotations, pkgAnnotations)
 	}
 
-	return results, nil
+	return annotations, valid, nil
 }
 
-func splitLine(line string) (code, comment string) {
-	if i := strings.Index(line, "//"); i != -1 {
-		return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i:])
+// list prints the annotations found in the package without checking them.
+func list(opts Options) int {
+	annotations, valid, err := parsePackages(opts, opts.annotationOptions())
+	if err != nil {
+		log.Printf("error parsing source code: %s", err)
+		return exitInvalid
+	}
+
+	if !escapelint.ValidateAnnotations(annotations) {
+		valid = false
+	}
+
+	if err := writeList(os.Stdout, annotations); err != nil {
+		log.Printf("error writing annotations: %s", err)
+		return exitInvalid
+	}
+
+	if !valid {
+		return exitInvalid
 	}
 
-	return strings.TrimSpace(line), ""
+	return exitOK
 }
 
-func ParseCodeAnnotations(packagePath string) (map[Position][]Annotation, bool, error) {
-	annotations := make(map[Position][]Annotation)
+// lintAnnotations checks that the annotations are well-formed without the
+// compiler output. Every problem is logged, rather than only the first one.
+func lintAnnotations(opts Options) int {
+	annotationOpts := opts.annotationOptions()
+	annotationOpts.RejectCodeless = true
 
-	var (
-		noEscape      = fmt.Sprintf("//%s", NoEscape)
-		noBoundsCheck = fmt.Sprintf("//%s", NoBoundsCheck)
-		mustInline    = fmt.Sprintf("//%s", MustInline)
-		valid         = true
-	)
+	annotations, valid, err := parsePackages(opts, annotationOpts)
+	if err != nil {
+		log.Printf("error parsing source code: %s", err)
+		return exitInvalid
+	}
 
-	err := filepath.Walk(packagePath, func(currentPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if !escapelint.ValidateAnnotations(annotations) {
+		valid = false
+	}
+
+	if !valid {
+		log.Printf("error: some annotations in %s are malformed", strings.Join(opts.Pkg, ", "))
+		return exitInvalid
+	}
+
+	n := 0
+	for _, anns := range annotations {
+		n += len(anns)
+	}
+
+	log.Printf("%d annotations are well-formed", n)
+
+	return exitOK
+}
+
+// run checks the annotations once and returns the exit code.
+func run(opts Options) int {
+	hints, err := readHints(opts)
+	if err != nil {
+		log.Printf("error reading compiler output: %s", err)
+		return exitInvalid
+	}
+
+	// Without any hints, all no-escape annotations would silently pass, which
+	// almost always means that the wrong output has been captured.
+	if len(hints) == 0 {
+		severity := "error"
+		if opts.AllowEmpty {
+			severity = "warning"
 		}
 
-		// Skip hidden directories and vendor
-		if info.IsDir() && info.Name() != "." && (strings.HasPrefix(info.Name(), ".") || info.Name() == "vendor") {
-			return filepath.SkipDir
+		log.Printf("%s: no compiler hints found; was the package built with -gcflags=\"%s\" and stderr captured (2>&1)?",
+			severity, escapelint.DefaultGCFlags)
+
+		if !opts.AllowEmpty {
+			return exitInvalid
 		}
+	}
+
+	// The previous report is read before the new one is written, since both
+	// may be the same file.
+	var previous jsonReport
 
-		// Skip non-Go files
-		if info.IsDir() || !strings.HasSuffix(currentPath, ".go") {
-			return nil
+	if opts.CompareTo != "" {
+		if previous, err = readJSONReport(opts.CompareTo); err != nil {
+			log.Printf("error reading previous report: %s", err)
+			return exitInvalid
 		}
+	}
+
+	// The typos are reported along with the findings rather than logged.
+	var typos []escapelint.Typo
 
-		// Skip test files
-		if strings.HasSuffix(currentPath, "_test.go") {
-			return nil
+	annotationOpts := opts.annotationOptions()
+	annotationOpts.OnTypo = func(typo escapelint.Typo) {
+		typos = append(typos, typo)
+	}
+
+	if opts.Since != "" {
+		files, err := changedPackageFiles(opts.Pkg, opts.Since)
+
+		switch {
+		case errors.Is(err, errNotGitRepo):
+			log.Printf("warning: %s is not in a git repository, checking all files instead of the ones changed since %s",
+				strings.Join(opts.Pkg, ", "), opts.Since)
+		case err != nil:
+			log.Printf("error listing changed files: %s", err)
+			return exitInvalid
+		default:
+			annotationOpts.Files = files
 		}
+	}
+
+	annotations, annotationsValid, err := parsePackages(opts, annotationOpts)
+	if err != nil {
+		log.Printf("error parsing source code: %s", err)
+		return exitInvalid
+	}
 
-		file, err := os.Open(currentPath)
+	// Like the missing hints, a package without any annotations would always
+	// pass, which may hide a wrong -pkg or a mistake in the annotation syntax.
+	if len(annotations) == 0 && opts.RequireAnnotations {
+		log.Printf("error: no annotations found in %s; does -pkg point to the right directory?", strings.Join(opts.Pkg, ", "))
+		return exitInvalid
+	}
+
+	if opts.DiffFile != "" {
+		root := diffRoot(opts)
+
+		changed, err := readDiff(opts.DiffFile, root)
 		if err != nil {
-			return err
+			log.Printf("error parsing diff: %s", err)
+			return exitInvalid
 		}
 
-		defer func() {
-			_ = file.Close()
-		}()
+		// Otherwise nothing would be checked, and the run would always pass.
+		if len(changed) > 0 && !anyFileExists(changed) {
+			log.Printf("warning: none of the files in the diff exist in %s; use -diff-root to set the directory its paths are relative to", root)
+		}
 
-		scanner := bufio.NewScanner(file)
-		lineNum := 0
+		for pos := range annotations {
+			if !changed[pos] {
+				delete(annotations, pos)
+			}
+		}
 
-		for scanner.Scan() {
-			lineNum++
+		typos = slices.DeleteFunc(typos, func(typo escapelint.Typo) bool { return !changed[typo.Position] })
+	}
 
-			line := scanner.Text()
-			code, comment := splitLine(line)
-			var lineAnnotations []Annotation
+	if !escapelint.ValidateAnnotations(annotations) {
+		annotationsValid = false
+	}
 
-			if code == "" || comment == "" {
-				continue
-			}
+	compareOpts := opts.compareOptions()
+	compareOpts.Typos = typos
 
-			switch {
-			case strings.Contains(comment, noEscape):
-				lineAnnotations = append(lineAnnotations, NoEscape)
-			case strings.Contains(comment, noBoundsCheck):
-				lineAnnotations = append(lineAnnotations, NoBoundsCheck)
-			case strings.Contains(comment, mustInline):
-				lineAnnotations = append(lineAnnotations, MustInline)
-			}
+	report := escapelint.CompareResults(hints, annotations, compareOpts)
 
-			if len(lineAnnotations) > 0 {
-				normalizedFile := path.Clean(currentPath)
-				lineKey := Position{File: normalizedFile, Line: lineNum}
-				annotations[lineKey] = append(annotations[lineKey], lineAnnotations...)
-			}
+	if opts.StrictWarnings {
+		report = promoteWarnings(report)
+	}
 
-			// We haven't found any annotations, but there is some suspicious comment.
-			// Let’s check if this might be an annotation with a typo.
-			if len(lineAnnotations) == 0 && len(comment) <= maxCommentLength {
-				for _, ann := range knownAnnotations {
-					if levenshteinDistance(comment, string(ann)) <= levenshteinThreshold {
-						log.Printf("probably a typo '%s' at %s:%d", comment, currentPath, lineNum)
-						valid = false
-					}
-				}
-			}
-		}
+	for _, dir := range report.Uninstrumented {
+		log.Printf("warning: no compiler hints for the package in %s, its annotations are not checked", dir)
+	}
+
+	// Packages missing from the output are tolerated when only some of them
+	// were built with -m, but if none of them is there, the output is more
+	// likely to be of another build, or to have paths that do not resolve.
+	if report.Checked == 0 && len(report.Uninstrumented) > 0 && len(hints) > 0 {
+		log.Print("error: none of the packages with annotations appear in the compiler output; " +
+			"do -f and -pkg refer to the same build? Use -instrumented to name the packages built with -m")
+		return exitInvalid
+	}
 
-		if err := scanner.Err(); err != nil {
-			return err
+	// Positions in the report stay canonical, only the printed paths change.
+	output := rewritePaths(report, opts.PathMode, opts.BaseDir)
+
+	if opts.OutputFile != "" {
+		err = writeReportFile(opts.OutputFile, output, opts)
+	} else {
+		// Human-readable output goes to stderr along with the logs, while
+		// machine-readable formats own stdout.
+		out := os.Stdout
+		if opts.Format == "text" {
+			out = os.Stderr
 		}
 
-		return nil
-	})
+		err = formatters[opts.Format](out, output, opts)
+	}
 
 	if err != nil {
-		return nil, valid, err
+		log.Printf("error writing report: %s", err)
+		return exitInvalid
 	}
 
-	return annotations, valid, nil
-}
+	if opts.WarnRedundant {
+		if err := writeRedundant(os.Stderr, report, opts); err != nil {
+			log.Printf("error writing report: %s", err)
+			return exitInvalid
+		}
+	}
 
-func CompareResults(
-	compilerHints map[Position][]CompilerHint,
-	codeAnnotations map[Position][]Annotation,
-) (valid bool) {
-	valid = true
-
-	for pos, annotations := range codeAnnotations {
-		hints := compilerHints[pos]
-
-		for _, ann := range annotations {
-			switch ann {
-			case NoEscape:
-				if slices.Contains(hints, EscapesToHeap) || slices.Contains(hints, MovedToHeap) {
-					log.Printf("variable at %s:%d is marked as %s but escapes to heap", pos.File, pos.Line, ann)
-					valid = false
-				}
-			case NoBoundsCheck:
-				if slices.Contains(hints, FoundIsInBounds) {
-					log.Printf("variable at %s:%d is marked as %s but bounds check is not eliminated", pos.File, pos.Line, ann)
-					valid = false
-				}
-			case MustInline:
-				if !slices.Contains(hints, Inlined) {
-					log.Printf("function at %s:%d is marked as %s but is not inlined", pos.File, pos.Line, ann)
-					valid = false
-				}
-			}
+	if opts.Stats && opts.Format != "json" {
+		if err := writeStats(os.Stderr, report); err != nil {
+			log.Printf("error writing report: %s", err)
+			return exitInvalid
 		}
 	}
 
-	return valid
-}
+	// A package without hints is not checked at all, which is only tolerated
+	// as a warning.
+	failed := !report.Valid() || opts.StrictWarnings && len(report.Uninstrumented) > 0
 
-type Options struct {
-	Pkg       string
-	InputFile string
-	NoFail    bool
-}
+	if opts.CompareTo != "" {
+		delta := compareReports(previous.Findings, newJSONReport(output, false).Findings)
+
+		if err := writeDelta(os.Stderr, delta, opts.CompareTo); err != nil {
+			log.Printf("error writing report: %s", err)
+			return exitInvalid
+		}
+
+		if opts.OnlyNew {
+			failed = delta.newErrors() > 0
+		}
+	}
 
-func parseOptions() Options {
-	opts := Options{}
-	flag.BoolVar(&opts.NoFail, "no-fail", false, "Exit with status code 0 even if errors are found")
-	flag.StringVar(&opts.InputFile, "f", "", "Path to the compiler output file")
-	flag.StringVar(&opts.Pkg, "pkg", ".", "Path to the package directory")
-	flag.Parse()
+	if opts.Fix != "" {
+		if err := runFix(os.Stderr, opts.Fix, report); err != nil {
+			log.Printf("error fixing source code: %s", err)
+			return exitInvalid
+		}
+	}
 
-	if opts.InputFile == "" {
-		log.Println("error: compiler output file is required")
-		flag.Usage()
-		os.Exit(1)
+	// The summary goes last, after all the other output.
+	if opts.MachineSummary {
+		if err := writeMachineSummary(os.Stderr, report); err != nil {
+			log.Printf("error writing report: %s", err)
+			return exitInvalid
+		}
 	}
 
-	return opts
+	warned := len(report.Findings) > report.Errors()
+
+	return exitCode(opts, annotationsValid, failed, warned)
 }
 
-func main() {
-	opts := parseOptions()
+// failLevels lists the accepted values of -fail-on. The empty one fails on the
+// violations and on malformed annotations, but not on warnings.
+var failLevels = []string{"", "error", "warning", "never"}
 
-	log.SetPrefix(logPrefix)
-	log.SetOutput(os.Stdout)
-	log.SetFlags(0)
+// promoteWarnings returns a copy of the report with the warnings turned into
+// errors, except for the acknowledged failures of the annotations marked with
+// :allow, which would otherwise have to be removed to pass.
+func promoteWarnings(report escapelint.Report) escapelint.Report {
+	report.Findings = slices.Clone(report.Findings)
 
-	hints, err := ParseCompilerOutput(opts.InputFile)
-	if err != nil {
-		log.Fatalf("error parsing compiler output: %s", err)
+	for i, finding := range report.Findings {
+		if finding.Severity == escapelint.SeverityWarning && !finding.Annotation.Allow {
+			report.Findings[i].Severity = escapelint.SeverityError
+		}
 	}
 
-	annotations, annotationsValid, err := ParseCodeAnnotations(opts.Pkg)
-	if err != nil {
-		log.Fatalf("error parsing source code: %s", err)
-	}
+	return report
+}
 
-	resultValid := CompareResults(hints, annotations)
+// exitCode maps the outcome of a check to the exit code, depending on the lowest
+// severity that fails the check.
+func exitCode(opts Options, annotationsValid, failed, warned bool) int {
+	failOn := opts.FailOn
+	if opts.NoFail {
+		failOn = "never"
+	}
 
-	if (!annotationsValid || !resultValid) && !opts.NoFail {
-		os.Exit(1)
+	switch {
+	case failOn == "never":
+		return exitOK
+	case !annotationsValid && failOn != "error":
+		return exitInvalid
+	case failed, warned && failOn == "warning":
+		return exitFailure
 	}
+
+	return exitOK
 }
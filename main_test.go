@@ -1,163 +1,511 @@
 package main
 
 import (
+	"bytes"
+	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"reflect"
+	"strings"
 	"testing"
 )
 
-func TestParseCompilerOutput(t *testing.T) {
-	// Create a temporary directory.
+func TestRunRequireAnnotations(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	// Create a temporary file with compiler output.
-	compilerOutput := `
-main.go:10: moved to heap: main
-main.go:15: escapes to heap: main
-main.go:20: stays on stack: main
-main.go:25: inlining call: main
-main.go:30: Found IsInBounds
-`
-	tmpFile := filepath.Join(tmpDir, "compiler_output.txt")
-	if err := os.WriteFile(tmpFile, []byte(compilerOutput), 0644); err != nil {
-		t.Fatalf("failed to write to temp file: %v", err)
-	}
-
-	// Call ParseCompilerOutput with the temp file.
-	results, err := ParseCompilerOutput(tmpFile)
+	files := map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\tx := new(int)\n\t_ = x\n}\n",
+		"build.log": "./main.go:4:10: new(int) does not escape\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", filepath.Join(tmpDir, "build.log"), "-o", filepath.Join(tmpDir, "report.txt")})
 	if err != nil {
-		t.Fatalf("ParseCompilerOutput failed: %v", err)
+		t.Fatalf("parseOptions failed: %v", err)
 	}
 
-	// Create expected results with normalized paths.
-	expected := map[Position][]CompilerHint{
-		{File: filepath.Join(tmpDir, "main.go"), Line: 10}: {MovedToHeap},
-		{File: filepath.Join(tmpDir, "main.go"), Line: 15}: {EscapesToHeap},
-		{File: filepath.Join(tmpDir, "main.go"), Line: 20}: {StaysOnStack},
-		{File: filepath.Join(tmpDir, "main.go"), Line: 25}: {Inlined},
-		{File: filepath.Join(tmpDir, "main.go"), Line: 30}: {FoundIsInBounds},
+	if code := run(opts); code != exitOK {
+		t.Errorf("expected exit code %d without annotations, got %d", exitOK, code)
 	}
 
-	if !reflect.DeepEqual(results, expected) {
-		t.Errorf("expected %v, got %v", expected, results)
+	opts.RequireAnnotations = true
+
+	if code := run(opts); code != exitInvalid {
+		t.Errorf("expected exit code %d with -require-annotations, got %d", exitInvalid, code)
 	}
 }
 
-func TestParseCodeAnnotations(t *testing.T) {
+func TestRunMultiplePackages(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	mainGo := `
-package main
+	// The packages are scattered across the tree, and the one left out would
+	// fail if it was checked.
+	files := map[string]string{
+		"hot/alpha/main.go":  "package alpha\n\nfunc f() {\n\tx := new(int) //no-escape\n\t_ = x\n}\n",
+		"util/beta/main.go":  "package beta\n\nfunc g() {\n\ty := new(int) //no-escape\n\t_ = y\n}\n",
+		"cold/gamma/main.go": "package gamma\n\nfunc h() {\n\tz := new(int) //no-escape\n\t_ = z\n}\n",
+		"build.log": "./hot/alpha/main.go:4:10: new(int) escapes to heap\n" +
+			"./util/beta/main.go:4:10: new(int) does not escape\n" +
+			"./cold/gamma/main.go:4:10: new(int) escapes to heap\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	alpha, beta := filepath.Join(tmpDir, "hot", "alpha"), filepath.Join(tmpDir, "util", "beta")
+	reportFile := filepath.Join(tmpDir, "report.txt")
 
-func main() {
-	var a int //no-escape
-	var b int //no-bounds-check
-	var c int //must-inline
+	// A package given twice, or within another one, is only walked once.
+	opts, err := parseOptions([]string{"-pkg", alpha + "," + beta, "-pkg", filepath.Join(alpha, "main.go"),
+		"-f", filepath.Join(tmpDir, "build.log"), "-o", reportFile})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	if code := run(opts); code != exitFailure {
+		t.Errorf("expected exit code %d, got %d", exitFailure, code)
+	}
+
+	report, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("alpha", "main.go") + ":4 is marked as no-escape but escapes to heap",
+		"1 failure across 1 file (2 annotations checked",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(string(report), line) {
+			t.Errorf("expected the report to contain %q, got:\n%s", line, report)
+		}
+	}
 }
-`
-	mainGoFile := filepath.Join(tmpDir, "main.go")
-	if err := os.WriteFile(mainGoFile, []byte(mainGo), 0644); err != nil {
-		t.Fatalf("failed to write to main.go: %v", err)
+
+func TestRunFailOn(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A violation, a stale annotation, a typo and a malformed annotation.
+	files := map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\tx := new(int) //no-escape\n\t_ = x //no-inline\n\ty := 1 //no-escap\n\t_ = y //no-bounds-check:amd64,amr64\n}\n",
+		"build.log": "./main.go:4:10: new(int) escapes to heap\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := map[string]int{
+		"":        exitInvalid,
+		"error":   exitFailure,
+		"warning": exitInvalid,
+		"never":   exitOK,
 	}
 
-	results, valid, err := ParseCodeAnnotations(tmpDir)
+	for failOn, expected := range tests {
+		t.Run(failOn, func(t *testing.T) {
+			opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", filepath.Join(tmpDir, "build.log"),
+				"-o", filepath.Join(tmpDir, "report.txt"), "-fail-on", failOn})
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+
+			if code := run(opts); code != expected {
+				t.Errorf("expected exit code %d, got %d", expected, code)
+			}
+		})
+	}
+
+	// The typo is reported along with the other findings.
+	report, err := os.ReadFile(filepath.Join(tmpDir, "report.txt"))
 	if err != nil {
-		t.Fatalf("ParseCodeAnnotations failed: %v", err)
+		t.Fatalf("failed to read report: %v", err)
+	}
+
+	if !strings.Contains(string(report), "did you mean //no-escape?") {
+		t.Errorf("expected the report to suggest //no-escape, got:\n%s", report)
 	}
+}
+
+func TestRunDiffTypos(t *testing.T) {
+	tmpDir := t.TempDir()
 
-	expected := map[Position][]Annotation{
-		{File: mainGoFile, Line: 5}: {NoEscape},
-		{File: mainGoFile, Line: 6}: {NoBoundsCheck},
-		{File: mainGoFile, Line: 7}: {MustInline},
+	// The typo is on a line that the diff does not touch.
+	files := map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\tx := new(int)\n\t_ = x\n\ty := 1 //no-escap\n\t_ = y\n}\n",
+		"build.log": "./main.go:4:10: new(int) escapes to heap\n",
+		"main.diff": "--- a/main.go\n+++ b/main.go\n@@ -5 +5 @@\n-\t_ = 0\n+\t_ = x\n",
 	}
 
-	if !reflect.DeepEqual(results, expected) {
-		t.Errorf("expected %v, got %v", expected, results)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
 	}
 
-	if !valid {
-		t.Errorf("expected annotations to be valid")
+	tests := []struct {
+		flags    []string
+		expected int
+	}{
+		{flags: nil, expected: exitFailure},
+		{flags: []string{"-diff", filepath.Join(tmpDir, "main.diff"), "-diff-root", tmpDir}, expected: exitOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.flags, " "), func(t *testing.T) {
+			args := append([]string{"-pkg", tmpDir, "-f", filepath.Join(tmpDir, "build.log"),
+				"-o", filepath.Join(t.TempDir(), "report.txt"), "-fail-on", "warning"}, tt.flags...)
+
+			opts, err := parseOptions(args)
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+
+			if code := run(opts); code != tt.expected {
+				t.Errorf("expected exit code %d, got %d", tt.expected, code)
+			}
+		})
 	}
 }
 
-func TestCompareResults(t *testing.T) {
+func TestRunDiffRoot(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "sub")
+
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", subDir, err)
+	}
+
+	// The paths in the diff are relative to the root of the repository rather
+	// than the package checked.
+	files := map[string]string{
+		"sub/main.go":   "package main\n\nfunc main() {\n\tx := new(int) //no-escape\n\t_ = x\n}\n",
+		"sub/build.log": "./main.go:4:10: new(int) escapes to heap\n",
+		"main.diff":     "--- a/sub/main.go\n+++ b/sub/main.go\n@@ -4 +4 @@\n-\tx := 0\n+\tx := new(int) //no-escape\n",
+		"other.diff":    "--- a/other/main.go\n+++ b/other/main.go\n@@ -4 +4 @@\n-\tx := 0\n+\tx := 1\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if output, err := exec.Command("git", "init", "-q", tmpDir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, output)
+	}
+
 	tests := []struct {
-		name            string
-		compilerHints   map[Position][]CompilerHint
-		codeAnnotations map[Position][]Annotation
-		expectedValid   bool
+		diff     string
+		expected int
+		warning  bool
+	}{
+		{diff: "main.diff", expected: exitFailure},
+		{diff: "other.diff", expected: exitOK, warning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.diff, func(t *testing.T) {
+			opts, err := parseOptions([]string{"-pkg", subDir, "-f", filepath.Join(subDir, "build.log"),
+				"-o", filepath.Join(t.TempDir(), "report.txt"), "-diff", filepath.Join(tmpDir, tt.diff)})
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+
+			var logs bytes.Buffer
+
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			if code := run(opts); code != tt.expected {
+				t.Errorf("expected exit code %d, got %d\n%s", tt.expected, code, logs.String())
+			}
+
+			if warned := strings.Contains(logs.String(), "none of the files in the diff exist"); warned != tt.warning {
+				t.Errorf("expected a warning about the diff paths: %t, got:\n%s", tt.warning, logs.String())
+			}
+		})
+	}
+}
+
+func TestRunMaxFindings(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The first finding is a warning, so the printed ones alone would pass.
+	files := map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\t_ = 1 //no-inline\n\tx := new(int) //no-escape\n\t_ = x\n}\n",
+		"build.log": "./main.go:5:10: new(int) escapes to heap\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	reportFile := filepath.Join(tmpDir, "report.txt")
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", filepath.Join(tmpDir, "build.log"), "-o", reportFile, "-max-findings", "1"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	if code := run(opts); code != exitFailure {
+		t.Errorf("expected exit code %d, got %d", exitFailure, code)
+	}
+
+	report, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+
+	if strings.Contains(string(report), "escapes to heap") || !strings.Contains(string(report), "... and 1 more") {
+		t.Errorf("expected only the first finding to be printed, got:\n%s", report)
+	}
+}
+
+func TestRunStrictWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A stale annotation and an acknowledged failure, which are both warnings.
+	files := map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\t_ = 1 //no-inline\n\tx := new(int) //no-escape:allow\n\t_ = x\n}\n",
+		"build.log": "./main.go:5:10: new(int) escapes to heap\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		flags    []string
+		expected int
+		summary  string
+	}{
+		{flags: nil, expected: exitOK, summary: "0 failures across 0 files"},
+		{flags: []string{"-strict-warnings"}, expected: exitFailure, summary: "1 failure across 1 file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.flags, " "), func(t *testing.T) {
+			reportFile := filepath.Join(tmpDir, "report.txt")
+
+			args := append([]string{"-pkg", tmpDir, "-f", filepath.Join(tmpDir, "build.log"), "-o", reportFile}, tt.flags...)
+
+			opts, err := parseOptions(args)
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+
+			if code := run(opts); code != tt.expected {
+				t.Errorf("expected exit code %d, got %d", tt.expected, code)
+			}
+
+			report, err := os.ReadFile(reportFile)
+			if err != nil {
+				t.Fatalf("failed to read report: %v", err)
+			}
+
+			// The allowed failure stays a warning either way.
+			if !strings.Contains(string(report), tt.summary) || !strings.Contains(string(report), "warning: variable at") {
+				t.Errorf("expected %q and a warning about the allowed failure, got:\n%s", tt.summary, report)
+			}
+		})
+	}
+}
+
+func TestRunUninstrumented(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The only hints are about another package, as if -pkg was wrong.
+	files := map[string]string{
+		"app/main.go":   "package main\n\nfunc main() {\n\tx := new(int) //no-escape\n\t_ = x\n}\n",
+		"other/main.go": "package main\n\nfunc main() {\n\tx := new(int)\n\t_ = x\n}\n",
+		"build.log":     "./other/main.go:4:10: new(int) escapes to heap\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		flags    []string
+		expected int
+		summary  string
+	}{
+		{flags: nil, expected: exitInvalid},
+		{flags: []string{"-instrumented", filepath.Join(tmpDir, "other")}, expected: exitOK, summary: "0 annotations checked, 0 matched no compiler hints, 1 skipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.flags, " "), func(t *testing.T) {
+			reportFile := filepath.Join(t.TempDir(), "report.txt")
+
+			args := append([]string{"-pkg", filepath.Join(tmpDir, "app"), "-f", filepath.Join(tmpDir, "build.log"), "-o", reportFile}, tt.flags...)
+
+			opts, err := parseOptions(args)
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+
+			if code := run(opts); code != tt.expected {
+				t.Errorf("expected exit code %d, got %d", tt.expected, code)
+			}
+
+			if tt.summary == "" {
+				return
+			}
+
+			report, err := os.ReadFile(reportFile)
+			if err != nil {
+				t.Fatalf("failed to read report: %v", err)
+			}
+
+			if !strings.Contains(string(report), tt.summary) {
+				t.Errorf("expected %q, got:\n%s", tt.summary, report)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		failOn   string
+		valid    bool
+		failed   bool
+		warned   bool
+		expected int
+	}{
+		{failOn: "", valid: true, warned: true, expected: exitOK},
+		{failOn: "", valid: true, failed: true, warned: true, expected: exitFailure},
+		{failOn: "error", valid: false, warned: true, expected: exitOK},
+		{failOn: "error", valid: false, failed: true, expected: exitFailure},
+		{failOn: "warning", valid: true, warned: true, expected: exitFailure},
+		{failOn: "warning", valid: true, expected: exitOK},
+		{failOn: "never", valid: false, failed: true, warned: true, expected: exitOK},
+	}
+
+	for _, tt := range tests {
+		if code := exitCode(Options{FailOn: tt.failOn}, tt.valid, tt.failed, tt.warned); code != tt.expected {
+			t.Errorf("-fail-on %q with valid=%v failed=%v warned=%v: expected exit code %d, got %d",
+				tt.failOn, tt.valid, tt.failed, tt.warned, tt.expected, code)
+		}
+	}
+
+	if code := exitCode(Options{NoFail: true}, false, true, true); code != exitOK {
+		t.Errorf("expected exit code %d with -no-fail, got %d", exitOK, code)
+	}
+}
+
+func TestLintAnnotations(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected []string
 	}{
 		{
-			name: "validCases",
-			compilerHints: map[Position][]CompilerHint{
-				{File: "main.go", Line: 10}: {StaysOnStack},
-				{File: "main.go", Line: 15}: {StaysOnStack},
-				{File: "main.go", Line: 25}: {Inlined},
-			},
-			codeAnnotations: map[Position][]Annotation{
-				{File: "main.go", Line: 10}: {NoEscape},
-				{File: "main.go", Line: 15}: {NoEscape},
-				{File: "main.go", Line: 20}: {NoBoundsCheck},
-				{File: "main.go", Line: 25}: {MustInline},
-			},
-			expectedValid: true,
+			name:   "valid",
+			source: "package main\n\nfunc main() {\n\tx := 1 //no-escape\n\t_ = x\n}\n",
 		},
 		{
-			name: "invalidNoEscape",
-			compilerHints: map[Position][]CompilerHint{
-				{File: "main.go", Line: 10}: {EscapesToHeap},
-				{File: "main.go", Line: 15}: {MovedToHeap},
-				{File: "main.go", Line: 20}: {StaysOnStack},
-				{File: "main.go", Line: 25}: {Inlined},
-			},
-			codeAnnotations: map[Position][]Annotation{
-				{File: "main.go", Line: 10}: {NoEscape},
-				{File: "main.go", Line: 15}: {NoEscape},
-				{File: "main.go", Line: 20}: {NoBoundsCheck},
-				{File: "main.go", Line: 25}: {MustInline},
-			},
-			expectedValid: false,
+			name:     "typo",
+			source:   "package main\n\nfunc main() {\n\tx := 1 //noescape\n\t_ = x\n}\n",
+			expected: []string{"probably a typo '//noescape' at"},
 		},
 		{
-			name: "invalidNoBoundsCheck",
-			compilerHints: map[Position][]CompilerHint{
-				{File: "main.go", Line: 10}: {StaysOnStack},
-				{File: "main.go", Line: 15}: {StaysOnStack},
-				{File: "main.go", Line: 20}: {FoundIsInBounds},
-				{File: "main.go", Line: 25}: {Inlined},
-			},
-			codeAnnotations: map[Position][]Annotation{
-				{File: "main.go", Line: 10}: {NoEscape},
-				{File: "main.go", Line: 15}: {NoEscape},
-				{File: "main.go", Line: 20}: {NoBoundsCheck},
-				{File: "main.go", Line: 25}: {MustInline},
-			},
-			expectedValid: false,
+			name:     "conflict",
+			source:   "package main\n\nfunc main() {\n\tadd(1) //must-inline //no-inline\n}\n\nfunc add(int) {}\n",
+			expected: []string{"conflicting annotations must-inline and no-inline at"},
 		},
 		{
-			name: "invalidMustInline",
-			compilerHints: map[Position][]CompilerHint{
-				{File: "main.go", Line: 10}: {StaysOnStack},
-				{File: "main.go", Line: 15}: {StaysOnStack},
-				{File: "main.go", Line: 20}: {StaysOnStack},
-				{File: "main.go", Line: 25}: {StaysOnStack},
-			},
-			codeAnnotations: map[Position][]Annotation{
-				{File: "main.go", Line: 10}: {NoEscape},
-				{File: "main.go", Line: 15}: {NoEscape},
-				{File: "main.go", Line: 20}: {NoBoundsCheck},
-				{File: "main.go", Line: 25}: {MustInline},
+			name:     "codeless",
+			source:   "package main\n\nfunc main() {\n\t//no-escape\n}\n",
+			expected: []string{"annotation on a line without code at"},
+		},
+		{
+			name:     "unknownArch",
+			source:   "package main\n\nfunc main() {\n\ts := []int{1}\n\t_ = s[0] //no-bounds-check:amd64,amr64\n}\n",
+			expected: []string{"unknown architecture amr64 in no-bounds-check at"},
+		},
+		{
+			name:     "funcScope",
+			source:   "package main\n\nfunc main() {\n\tx := 1 //no-escape-func\n\t_ = x\n}\n",
+			expected: []string{"function annotation is not on a function at"},
+		},
+		{
+			// All problems are reported, not only the first one.
+			name:   "several",
+			source: "package main\n\nfunc main() { //no-escape-begin\n\tx := 1 //noescape\n\t//no-escape\n\t_ = x\n}\n",
+			expected: []string{
+				"probably a typo '//noescape' at",
+				"annotation on a line without code at",
+				"no-escape-begin at",
 			},
-			expectedValid: false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			valid := CompareResults(tt.compilerHints, tt.codeAnnotations)
-			if valid != tt.expectedValid {
-				t.Fatalf("expected %v, got %v", tt.expectedValid, valid)
+			tmpDir := t.TempDir()
+
+			if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(tt.source), 0644); err != nil {
+				t.Fatalf("failed to write main.go: %v", err)
+			}
+
+			opts, err := parseOptions([]string{"-pkg", tmpDir, "-lint-annotations"})
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+
+			var logs bytes.Buffer
+
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			expectedCode := exitOK
+			if len(tt.expected) > 0 {
+				expectedCode = exitInvalid
+			}
+
+			if code := lintAnnotations(opts); code != expectedCode {
+				t.Errorf("expected exit code %d, got %d\n%s", expectedCode, code, logs.String())
+			}
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(logs.String(), expected) {
+					t.Errorf("expected %q to be logged, got:\n%s", expected, logs.String())
+				}
 			}
 		})
 	}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+const usageExitCodes = `
+Exit codes:
+  0  no problems found
+  1  some annotations are not satisfied by the compiler output
+  2  invalid usage, unreadable input, or malformed annotations
+`
+
+// stringList is a flag that can be repeated or given a comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Get returns the items, so that the effective configuration lists them as an array.
+func (l *stringList) Get() any {
+	return append([]string{}, *l...)
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+
+	return nil
+}
+
+// repeatedList is a flag that can be repeated. Unlike stringList, the values
+// are kept intact, since they may contain commas, e.g. in regular expressions.
+type repeatedList []string
+
+func (l *repeatedList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *repeatedList) Get() any {
+	return append([]string{}, *l...)
+}
+
+func (l *repeatedList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseRule parses a custom rule given as "name=present:regex" or "name=absent:regex".
+func parseRule(value string) (escapelint.Rule, error) {
+	name, spec, ok := strings.Cut(value, "=")
+	polarity, pattern, ok2 := strings.Cut(spec, ":")
+
+	if !ok || !ok2 || name == "" {
+		return escapelint.Rule{}, fmt.Errorf("invalid rule %q, expected name=present:regex or name=absent:regex", value)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return escapelint.Rule{}, fmt.Errorf("invalid pattern of rule %s: %w", name, err)
+	}
+
+	rule := escapelint.Rule{Name: escapelint.AnnotationKind(name), Pattern: re}
+
+	switch polarity {
+	case "present":
+		rule.Present = true
+	case "absent":
+		rule.Present = false
+	default:
+		return escapelint.Rule{}, fmt.Errorf("invalid polarity of rule %s: %s, expected present or absent", name, polarity)
+	}
+
+	return rule, nil
+}
+
+type Options struct {
+	Pkg                stringList
+	InputFiles         stringList
+	InputFormat        string
+	MaxLineLength      int
+	DiffFile           string
+	DiffRoot           string
+	Since              string
+	CompareTo          string
+	OnlyNew            bool
+	Format             string
+	Color              string
+	OutputFile         string
+	Fix                string
+	Run                bool
+	GCFlags            string
+	List               bool
+	LintAnnotations    bool
+	Explain            string
+	Watch              bool
+	InstallHook        bool
+	Force              bool
+	PathMode           string
+	BaseDir            string
+	GOARCH             string
+	IgnorePathCase     bool
+	BCEWindow          int
+	StatementSpan      bool
+	NoFail             bool
+	FailOn             string
+	Strict             bool
+	StrictWarnings     bool
+	AllowEmpty         bool
+	Instrumented       stringList
+	RequireAnnotations bool
+	WarnRedundant      bool
+	MaxFindings        int
+	Stats              bool
+	MachineSummary     bool
+	Verbose            bool
+	PrintConfig        bool
+	TypoDistance       int
+	TypoMaxLength      int
+	Prefix             string
+	FollowSymlinks     bool
+	RespectGitignore   bool
+	SkipGenerated      bool
+	IncludeTests       bool
+	Cache              bool
+	Tags               stringList
+	Rules              repeatedList
+	Enable             stringList
+
+	rules        []escapelint.Rule
+	instrumented []string
+	useColor     bool
+	enabled      []escapelint.AnnotationKind
+	explainPos   escapelint.Position
+	config       map[string]any
+}
+
+func (o Options) annotationOptions() escapelint.AnnotationOptions {
+	// The cache keys include the file paths, so a single directory serves
+	// all the packages.
+	var cacheDir string
+	if o.Cache && len(o.Pkg) > 0 {
+		cacheDir = filepath.Join(packageDir(o.Pkg[0]), escapelint.CacheDirName)
+	}
+
+	return escapelint.AnnotationOptions{
+		TypoDistance:     o.TypoDistance,
+		TypoMaxLength:    o.TypoMaxLength,
+		Prefix:           o.Prefix,
+		FollowSymlinks:   o.FollowSymlinks,
+		SkipGenerated:    o.SkipGenerated,
+		StatementSpan:    o.StatementSpan,
+		RespectGitignore: o.RespectGitignore,
+		IncludeTests:     o.IncludeTests,
+		CacheDir:         cacheDir,
+		Tags:             o.Tags,
+		GOARCH:           o.GOARCH,
+	}
+}
+
+func (o Options) compareOptions() escapelint.CompareOptions {
+	return escapelint.CompareOptions{
+		Strict:         o.Strict,
+		GOARCH:         o.GOARCH,
+		BCEWindow:      o.BCEWindow,
+		Enabled:        o.enabled,
+		IgnorePathCase: o.IgnorePathCase,
+		Instrumented:   o.instrumented,
+	}
+}
+
+func newFlagSet(opts *Options) *flag.FlagSet {
+	flags := flag.NewFlagSet("go-escape-lint", flag.ContinueOnError)
+	flags.Usage = func() { usage(flags) }
+
+	flags.BoolVar(&opts.NoFail, "no-fail", false, "Exit with status code 0 even if errors are found")
+	flags.StringVar(&opts.FailOn, "fail-on", "", "Lowest severity failing the check: error (violations only, malformed annotations are not fatal),\n"+
+		"warning (also stale annotations and typos) or never (same as -no-fail); if empty, fail on violations and malformed annotations")
+	flags.BoolVar(&opts.Strict, "strict", false, "Fail on annotations that matched no compiler output instead of warning")
+	flags.BoolVar(&opts.StrictWarnings, "strict-warnings", false, "Turn all warnings into errors, such as stale annotations, typos and packages without compiler hints;\n"+
+		"the failures acknowledged with :allow stay warnings")
+	flags.BoolVar(&opts.List, "list", false, "List the annotations found in the package and exit without checking them")
+	flags.BoolVar(&opts.LintAnnotations, "lint-annotations", false, "Check that the annotations are well-formed, without typos, conflicts, unknown architectures\n"+
+		"or annotations on lines without code, and exit without reading the compiler output")
+	flags.BoolVar(&opts.Run, "run", false, "Build the package with -gcflags instead of reading the compiler output from -f")
+	flags.StringVar(&opts.GCFlags, "gcflags", escapelint.DefaultGCFlags, "Compiler flags used by -run, e.g. to add -l=4 or limit -m to a package pattern")
+	flags.StringVar(&opts.Explain, "explain", "", "Print the annotations, the compiler hints and the verdict at a single file:line position and exit")
+	flags.BoolVar(&opts.Watch, "watch", false, "Check again every time a Go file in the package changes (implies -run)")
+	flags.BoolVar(&opts.InstallHook, "install-hook", false, "Install a git pre-commit hook checking the staged lines of Go code and exit")
+	flags.BoolVar(&opts.Force, "force", false, "Replace an existing pre-commit hook with -install-hook")
+	flags.BoolVar(&opts.AllowEmpty, "allow-empty", false, "Do not fail if the compiler output has no hints at all")
+	flags.Var(&opts.Instrumented, "instrumented", "Packages built with -m, e.g. with -gcflags=pattern=-m, as directories or import paths, where a trailing /...\n"+
+		"covers the subdirectories (can be repeated or comma-separated); the annotations of other packages are skipped,\n"+
+		"while by default the packages without any compiler hints are skipped with a warning")
+	flags.BoolVar(&opts.RequireAnnotations, "require-annotations", false, "Fail if no annotations are found in the package")
+	flags.BoolVar(&opts.WarnRedundant, "warn-redundant", false, "Summarize the annotations of each kind that matched no compiler hints across the run")
+	flags.IntVar(&opts.MaxFindings, "max-findings", 0, "Print at most this many findings in the text and github formats,\n"+
+		"followed by the number of the omitted ones; the exit code still accounts for all of them (0 for no limit)")
+	flags.BoolVar(&opts.Stats, "stats", false, "Print the number of annotations of each kind that passed, failed, were allowed to fail or are stale;\n"+
+		"with -format json, they are added to the report as a stats object instead")
+	flags.BoolVar(&opts.MachineSummary, "machine-summary", false, "Finish with a line such as \"ESCAPE_LINT_RESULT failures=3 warnings=1 checked=12\" on stderr,\n"+
+		"whatever the output format, for scripts checking the outcome")
+	flags.Var(&opts.InputFiles, "f", "Path to the compiler output file (can be repeated or comma-separated)")
+	flags.StringVar(&opts.InputFormat, "input-format", "text", "Format of the compiler output: text or json (-gcflags=-json or go build -json)")
+	flags.StringVar(&opts.GOARCH, "goarch", defaultGOARCH(), "Architecture the compiler output was produced for; annotations qualified with other architectures are skipped")
+	flags.BoolVar(&opts.IgnorePathCase, "ignore-path-case", defaultIgnorePathCase(),
+		"Match the file paths of the compiler output and the source code regardless of case (default true on macOS and Windows)")
+	flags.IntVar(&opts.BCEWindow, "bce-window", 0, "Number of lines around a no-bounds-check annotation where bounds checks are also considered.\n"+
+		"A wider window catches checks reported at a neighboring line after inlining, but may blame unrelated accesses nearby")
+	flags.BoolVar(&opts.StatementSpan, "statement-span", escapelint.DefaultAnnotationOptions().StatementSpan,
+		"Match a no-escape annotation against the compiler hints at all lines of a statement spanning several lines,\n"+
+			"such as a wrapped call or a chain of method calls; set to false to match only its own line")
+	flags.Var(&opts.Pkg, "pkg", "Path to the package directory or a single Go file, or the import path of a package\n"+
+		"(can be repeated or comma-separated to check several packages in one run) (default .)")
+	flags.BoolVar(&opts.SkipGenerated, "skip-generated", escapelint.DefaultAnnotationOptions().SkipGenerated,
+		"Skip the files with a \"// Code generated ... DO NOT EDIT.\" header; set to false to check annotated generated code")
+	flags.BoolVar(&opts.RespectGitignore, "respect-gitignore", false, "Skip the files and directories in -pkg ignored by git, such as build artifacts")
+	flags.BoolVar(&opts.IncludeTests, "include-tests", false, "Also check the annotations in _test.go files, e.g. in benchmarks, against the output of\n"+
+		"go test -gcflags=-m -bench=. 2>&1; cannot be used with -run, which does not compile the tests")
+	flags.Var(&opts.Tags, "tags", "Build tags the compiler output was produced with (comma-separated, as for go build);\n"+
+		"if set, files excluded by their build constraints are skipped, and -run builds with these tags")
+	flags.BoolVar(&opts.Cache, "cache", false, "Cache the annotations parsed from each file in "+escapelint.CacheDirName+" in the package directory,\n"+
+		"so that only the files changed since the last run are parsed again")
+	flags.BoolVar(&opts.FollowSymlinks, "follow-symlinks", false, "Walk into symbolic links to directories in -pkg, which are skipped by default")
+	flags.StringVar(&opts.Format, "format", "text", "Output format: text (to stderr), json, github, checkstyle or quickfix (to stdout)")
+	flags.StringVar(&opts.Color, "color", "auto", "Color the text report: auto (if stderr is a terminal), always or never")
+	flags.StringVar(&opts.PathMode, "path-mode", "", "Print file paths as abs (absolute) or rel (relative to -base-dir); relative to the working directory if empty")
+	flags.StringVar(&opts.BaseDir, "base-dir", ".", "Base directory for relative file paths in the report, e.g. the repository root")
+	flags.StringVar(&opts.OutputFile, "o", "", "Write the report to a file instead of stdout/stderr")
+	flags.StringVar(&opts.DiffFile, "diff", "", "Only check lines added in the given unified diff (use - for stdin)")
+	flags.StringVar(&opts.DiffRoot, "diff-root", "", "Directory the file paths in the -diff are relative to;\n"+
+		"the root of the git repository of the package if empty, or the working directory outside of one")
+	flags.StringVar(&opts.Since, "since", "", "Only check the files changed since the given git ref, e.g. main, including uncommitted changes and untracked files;\n"+
+		"everything is checked outside of a git repository")
+	flags.StringVar(&opts.CompareTo, "compare-to", "", "Compare the findings with a report of a previous run written with -format json,\n"+
+		"and print the new and fixed ones")
+	flags.BoolVar(&opts.OnlyNew, "only-new", false, "Only fail on findings that are not in the -compare-to report")
+	flags.Var(&opts.Rules, "rule", "Custom annotation checked against the compiler messages, as name=present:regex\n"+
+		"or name=absent:regex to require or forbid a matching message at the annotated line (can be repeated)")
+	flags.Var(&opts.Enable, "enable", "Only check the annotations of the given kinds, e.g. must-inline,no-escape (can be repeated or comma-separated);\n"+
+		"all of them are checked if empty")
+	flags.StringVar(&opts.Prefix, "prefix", "", "Prefix required in every annotation, e.g. escape: for //escape:no-escape")
+	flags.IntVar(&opts.TypoDistance, "typo-distance", escapelint.DefaultAnnotationOptions().TypoDistance,
+		"Maximum edit distance between a comment and an annotation name to report it as a probable typo (0 to disable)")
+	flags.IntVar(&opts.TypoMaxLength, "typo-maxlen", escapelint.DefaultAnnotationOptions().TypoMaxLength,
+		"Maximum length of a comment that is checked for typos")
+	flags.IntVar(&opts.MaxLineLength, "max-line-length", escapelint.MaxLineLength, "Maximum length in bytes of a line in the compiler output or the source code")
+	flags.StringVar(&opts.Fix, "fix", "", "Rewrite the source files and print the changes as a diff.\n"+
+		"Supported modes: remove-stale (remove annotations that matched no compiler output)")
+	flags.BoolVar(&opts.Verbose, "v", false, "Log verbose diagnostics, such as skipped lines of compiler output")
+	flags.BoolVar(&opts.PrintConfig, "print-config", false, "Print the effective options as JSON, after applying the configuration file and the flags, and exit")
+
+	return flags
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	_, _ = fmt.Fprint(out, "Usage: go-escape-lint -f <compiler output> [options]\n")
+	_, _ = fmt.Fprint(out, "       go-escape-lint -run [options]\n")
+	_, _ = fmt.Fprint(out, "       go-escape-lint -install-hook [-force]\n\nOptions:\n")
+	flags.PrintDefaults()
+	_, _ = fmt.Fprintf(out, "\nDefaults can be set in the %s file in the package directory,\n", configFileName)
+	_, _ = fmt.Fprint(out, "using the flag names as keys, or in environment variables such as ESCAPE_LINT_NO_FAIL.\n")
+	_, _ = fmt.Fprint(out, "Command line flags take precedence over the environment, and both over the file.\n")
+	_, _ = fmt.Fprint(out, usageExitCodes)
+}
+
+// defaultIgnorePathCase reports whether the file paths are likely to differ in
+// case only, as on the case-insensitive filesystems of macOS and Windows.
+func defaultIgnorePathCase() bool {
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+func defaultGOARCH() string {
+	if goarch := os.Getenv("GOARCH"); goarch != "" {
+		return goarch
+	}
+
+	return runtime.GOARCH
+}
+
+// parseOptions parses the command line arguments on top of the defaults read
+// from the configuration file in the package directory.
+func parseOptions(args []string) (Options, error) {
+	opts := Options{}
+	flags := newFlagSet(&opts)
+
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// The flags take precedence over the environment, which takes precedence
+	// over the configuration file.
+	if err := applyEnv(flags, os.LookupEnv, explicit); err != nil {
+		return opts, err
+	}
+
+	// With several packages, the configuration file of the first one applies
+	// to all of them. It may be given by its import path rather than directory.
+	configPkg := "."
+	if len(opts.Pkg) > 0 {
+		configPkg = escapelint.ResolvePackageDir(opts.Pkg[0])
+	}
+
+	if err := applyConfigFile(flags, configPath(configPkg), explicit); err != nil {
+		return opts, err
+	}
+
+	if len(opts.Pkg) == 0 {
+		opts.Pkg = stringList{"."}
+	}
+
+	// The import paths are resolved once all the layers are merged, so that the
+	// packages set in the configuration file are resolved too.
+	for i, pkg := range opts.Pkg {
+		opts.Pkg[i] = escapelint.ResolvePackageDir(pkg)
+	}
+
+	opts.Pkg = packageRoots(opts.Pkg)
+
+	for _, pkg := range opts.Instrumented {
+		opts.instrumented = append(opts.instrumented, instrumentedDir(pkg))
+	}
+
+	if opts.Watch {
+		opts.Run = true
+	}
+
+	if len(opts.InputFiles) == 0 && !opts.Run && !opts.List && !opts.LintAnnotations && !opts.InstallHook && !opts.PrintConfig {
+		return opts, errors.New("compiler output file is required, or use -run to build the package")
+	}
+
+	if opts.IncludeTests && opts.Run {
+		return opts, errors.New("-include-tests cannot be used with -run, give the output of go test with -f instead")
+	}
+
+	if opts.Watch && opts.Fix != "" {
+		return opts, errors.New("-fix cannot be used with -watch")
+	}
+
+	if opts.InputFormat != "text" && opts.InputFormat != "json" {
+		return opts, fmt.Errorf("unknown input format: %s", opts.InputFormat)
+	}
+
+	if _, ok := formatters[opts.Format]; !ok {
+		return opts, fmt.Errorf("unknown output format: %s", opts.Format)
+	}
+
+	if !slices.Contains(colorModes, opts.Color) {
+		return opts, fmt.Errorf("unknown color mode: %s", opts.Color)
+	}
+
+	if !slices.Contains(failLevels, opts.FailOn) {
+		return opts, fmt.Errorf("unknown fail level: %s", opts.FailOn)
+	}
+
+	if !slices.Contains(pathModes, opts.PathMode) {
+		return opts, fmt.Errorf("unknown path mode: %s", opts.PathMode)
+	}
+
+	if _, ok := fixers[opts.Fix]; opts.Fix != "" && !ok {
+		return opts, fmt.Errorf("unknown fix mode: %s", opts.Fix)
+	}
+
+	if opts.OnlyNew && opts.CompareTo == "" {
+		return opts, errors.New("-only-new requires -compare-to")
+	}
+
+	if opts.MaxFindings < 0 {
+		return opts, fmt.Errorf("max findings must not be negative: %d", opts.MaxFindings)
+	}
+
+	if opts.BCEWindow < 0 {
+		return opts, fmt.Errorf("bce window must not be negative: %d", opts.BCEWindow)
+	}
+
+	for _, value := range opts.Rules {
+		rule, err := parseRule(value)
+		if err != nil {
+			return opts, err
+		}
+
+		opts.rules = append(opts.rules, rule)
+	}
+
+	// The custom rules are not registered yet, so their names are checked
+	// separately.
+	for _, name := range opts.Enable {
+		kind := escapelint.AnnotationKind(name)
+
+		isRule := slices.ContainsFunc(opts.rules, func(rule escapelint.Rule) bool { return rule.Name == kind })
+		if !escapelint.IsKnownAnnotation(kind) && !isRule {
+			return opts, fmt.Errorf("unknown annotation in -enable: %s", name)
+		}
+
+		opts.enabled = append(opts.enabled, kind)
+	}
+
+	if opts.TypoDistance < 0 || opts.TypoMaxLength < 0 {
+		return opts, errors.New("typo distance and max length must not be negative")
+	}
+
+	if opts.MaxLineLength <= 0 {
+		return opts, fmt.Errorf("max line length must be positive: %d", opts.MaxLineLength)
+	}
+
+	if opts.Explain != "" {
+		pos, err := parsePosition(opts.Explain)
+		if err != nil {
+			return opts, err
+		}
+
+		opts.explainPos = pos
+	}
+
+	if opts.PrintConfig {
+		opts.config = effectiveConfig(flags)
+	}
+
+	opts.useColor = colorEnabled(opts)
+
+	return opts, nil
+}
+
+// packageRoots returns the packages without the ones given twice or within the
+// directory of another one, which would be walked twice otherwise. The paths
+// are compared in their absolute form, but returned as given.
+func packageRoots(pkgs []string) stringList {
+	abs := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		abs[i] = pkg
+		if path, err := filepath.Abs(pkg); err == nil {
+			abs[i] = path
+		}
+	}
+
+	var roots stringList
+
+	for i, pkg := range pkgs {
+		covered := slices.ContainsFunc(abs[:i], func(other string) bool { return other == abs[i] })
+
+		for j, other := range abs {
+			if j != i && isDir(other) && strings.HasPrefix(abs[i], other+string(filepath.Separator)) {
+				covered = true
+			}
+		}
+
+		if !covered {
+			roots = append(roots, pkg)
+		}
+	}
+
+	return roots
+}
+
+// instrumentedDir resolves the package given with -instrumented to an absolute
+// directory, like the ones of the annotations, keeping the /... suffix.
+func instrumentedDir(pkg string) string {
+	pkg = filepath.FromSlash(pkg)
+
+	root, recursive := strings.CutSuffix(pkg, string(filepath.Separator)+"...")
+	if pkg == "..." {
+		root, recursive = ".", true
+	}
+
+	dir := escapelint.ResolvePackageDir(root)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	if recursive {
+		return filepath.Join(dir, "...")
+	}
+
+	return dir
+}
+
+// isDir tells whether the path is an existing directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// packageDir returns the directory of the package, which can be given either
+// as a directory or as a single file.
+func packageDir(pkg string) string {
+	if info, err := os.Stat(pkg); err == nil && !info.IsDir() {
+		return filepath.Dir(pkg)
+	}
+
+	return pkg
+}
+
+// configPath returns the location of the configuration file for the package.
+func configPath(pkg string) string {
+	return filepath.Join(packageDir(pkg), configFileName)
+}
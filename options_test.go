@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+func writeConfig(t *testing.T, dir, config string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func TestParseOptionsConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfig(t, tmpDir, "f: build.log\nstrict: true\ninput-format: json\n")
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-input-format", "text"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	expected := Options{
+		Pkg:            stringList{tmpDir},
+		InputFiles:     stringList{"build.log"},
+		InputFormat:    "text",
+		Format:         "text",
+		Color:          "auto",
+		GCFlags:        escapelint.DefaultGCFlags,
+		GOARCH:         defaultGOARCH(),
+		IgnorePathCase: defaultIgnorePathCase(),
+		BaseDir:        ".",
+		TypoDistance:   escapelint.DefaultAnnotationOptions().TypoDistance,
+		TypoMaxLength:  escapelint.DefaultAnnotationOptions().TypoMaxLength,
+		SkipGenerated:  true,
+		StatementSpan:  true,
+		MaxLineLength:  escapelint.MaxLineLength,
+		Strict:         true,
+	}
+
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, opts)
+	}
+}
+
+func TestParseOptionsNoConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", "build.log"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	if opts.Strict || opts.InputFormat != "text" {
+		t.Errorf("expected default options, got %+v", opts)
+	}
+}
+
+func TestParseOptionsUnknownConfigKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfig(t, tmpDir, "f: build.log\nstrikt: true\nlevel: 2\n")
+
+	_, err := parseOptions([]string{"-pkg", tmpDir})
+	if err == nil {
+		t.Fatalf("expected an error for unknown keys")
+	}
+
+	for _, key := range []string{`"strikt"`, `"level"`} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected error to mention %s, got %v", key, err)
+		}
+	}
+}
+
+func TestParseOptionsMultipleInputs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", "linux.log,darwin.log", "-f", "windows.log"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	expected := stringList{"linux.log", "darwin.log", "windows.log"}
+	if !reflect.DeepEqual(opts.InputFiles, expected) {
+		t.Errorf("expected %v, got %v", expected, opts.InputFiles)
+	}
+}
+
+func TestParseOptionsMultiplePackages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, dir := range []string{"alpha", "beta", filepath.Join("alpha", "inner")} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	alpha, beta := filepath.Join(tmpDir, "alpha"), filepath.Join(tmpDir, "beta")
+
+	opts, err := parseOptions([]string{"-pkg", alpha + "," + filepath.Join(alpha, "inner"), "-pkg", beta, "-pkg", alpha, "-f", "build.log"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	// The nested and repeated packages are walked along with the first one.
+	expected := []string{alpha, beta}
+	if !slices.Equal(opts.Pkg, expected) {
+		t.Errorf("expected the packages %v, got %v", expected, opts.Pkg)
+	}
+
+	// The configuration file of the first package applies to all of them.
+	writeConfig(t, alpha, "strict: true\n")
+
+	if opts, err = parseOptions([]string{"-pkg", alpha, "-pkg", beta, "-f", "build.log"}); err != nil || !opts.Strict {
+		t.Errorf("expected the configuration of %s to apply, got %+v (%v)", alpha, opts, err)
+	}
+}
+
+func TestParseOptionsConfigImportPath(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go list in short mode")
+	}
+
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+
+	files := map[string]string{
+		"go.mod":       "module example.com/small\n\ngo 1.22\n",
+		"hot/hot.go":   "package hot\n\nvar a = new(int) //no-escape\n",
+		configFileName: "pkg: example.com/small/hot\nf: build.log\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	opts, err := parseOptions(nil)
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	// The package set in the configuration file is resolved like the flag.
+	expected := []string{filepath.Join(tmpDir, "hot")}
+	if !slices.Equal(opts.Pkg, expected) {
+		t.Errorf("expected the packages %v, got %v", expected, opts.Pkg)
+	}
+}
+
+func TestParseOptionsEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfig(t, tmpDir, "f: config.log\nformat: json\nmax-findings: 5\n")
+
+	t.Setenv("ESCAPE_LINT_PKG", tmpDir)
+	t.Setenv("ESCAPE_LINT_NO_FAIL", "true")
+	t.Setenv("ESCAPE_LINT_FORMAT", "github")
+	t.Setenv("ESCAPE_LINT_TAGS", "purego,race")
+	t.Setenv("ESCAPE_LINT_STRICT", "")
+	t.Setenv("ESCAPE_LINT_F", "env.log")
+
+	opts, err := parseOptions([]string{"-f", "flag.log"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	// The package directory is taken from the environment before its
+	// configuration file is looked up.
+	if !slices.Equal(opts.Pkg, []string{tmpDir}) {
+		t.Errorf("expected the package %s, got %s", tmpDir, opts.Pkg)
+	}
+
+	if !opts.NoFail || opts.Format != "github" || !slices.Equal(opts.Tags, []string{"purego", "race"}) {
+		t.Errorf("expected the options to be set from the environment, got %+v", opts)
+	}
+
+	// The flags take precedence over the environment, which takes precedence
+	// over the configuration file, and empty variables are ignored.
+	if !slices.Equal(opts.InputFiles, []string{"flag.log"}) || opts.MaxFindings != 5 || opts.Strict {
+		t.Errorf("expected the flags, then the environment, then the file, got %+v", opts)
+	}
+
+	t.Setenv("ESCAPE_LINT_BCE_WINDOW", "wide")
+
+	if _, err := parseOptions(nil); err == nil || !strings.Contains(err.Error(), "ESCAPE_LINT_BCE_WINDOW") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfig(t, tmpDir, "format: json\nbce-window: 2\ntags: purego\n")
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-print-config", "-format", "checkstyle", "-strict"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := printConfig(&buf, opts); err != nil {
+		t.Fatalf("printConfig failed: %v", err)
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		t.Fatalf("failed to decode the config: %v\n%s", err, buf.String())
+	}
+
+	// The flags take precedence over the file, and the defaults fill the rest.
+	expected := map[string]any{
+		"pkg":        []any{tmpDir},
+		"format":     "checkstyle",
+		"strict":     true,
+		"bce-window": float64(2),
+		"tags":       []any{"purego"},
+		"gcflags":    escapelint.DefaultGCFlags,
+		"f":          []any{},
+	}
+
+	for key, value := range expected {
+		if !reflect.DeepEqual(config[key], value) {
+			t.Errorf("expected %s to be %v, got %v", key, value, config[key])
+		}
+	}
+
+	if _, ok := config["print-config"]; ok {
+		t.Errorf("expected print-config to be left out")
+	}
+}
+
+func TestParseOptionsWatch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-watch"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	if !opts.Run {
+		t.Errorf("expected -watch to imply -run")
+	}
+
+	if _, err := parseOptions([]string{"-pkg", tmpDir, "-watch", "-fix", "remove-stale"}); err == nil {
+		t.Errorf("expected an error for -fix with -watch")
+	}
+}
+
+func TestParseOptionsIncludeTests(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", "bench.log", "-include-tests"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	if !opts.annotationOptions().IncludeTests {
+		t.Errorf("expected the test files to be included")
+	}
+
+	// go build does not compile the test files, so their annotations would
+	// all be stale.
+	if _, err := parseOptions([]string{"-pkg", tmpDir, "-run", "-include-tests"}); err == nil {
+		t.Errorf("expected an error for -include-tests with -run")
+	}
+}
+
+func TestParseOptionsRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfig(t, tmpDir, "f: build.log\nrule: devirtualized=present:devirtualizing .* to \\*\nrule: 'no-closure=absent:func literal escapes'\n")
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	if len(opts.rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(opts.rules))
+	}
+
+	if rule := opts.rules[0]; rule.Name != "devirtualized" || !rule.Present || rule.Pattern.String() != `devirtualizing .* to \*` {
+		t.Errorf("unexpected first rule: %+v", rule)
+	}
+
+	if rule := opts.rules[1]; rule.Name != "no-closure" || rule.Present || rule.Pattern.String() != "func literal escapes" {
+		t.Errorf("unexpected second rule: %+v", rule)
+	}
+}
+
+func TestParseOptionsEnable(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	opts, err := parseOptions([]string{"-pkg", tmpDir, "-f", "build.log", "-enable", "must-inline,no-escape",
+		"-rule", "devirtualized=present:devirtualizing", "-enable", "devirtualized"})
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	expected := []escapelint.AnnotationKind{escapelint.MustInline, escapelint.NoEscape, "devirtualized"}
+	if !slices.Equal(opts.compareOptions().Enabled, expected) {
+		t.Errorf("expected enabled annotations %v, got %v", expected, opts.compareOptions().Enabled)
+	}
+
+	if _, err := parseOptions([]string{"-pkg", tmpDir, "-f", "build.log", "-enable", "must-inline,no-escpae"}); err == nil {
+		t.Errorf("expected an error for an unknown annotation")
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, value := range []string{"devirtualized", "devirtualized=present", "=present:x", "x=maybe:y", "x=absent:("} {
+		if _, err := parseRule(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// errNotGitRepo is returned by changedFiles outside of a git repository.
+var errNotGitRepo = errors.New("not a git repository")
+
+// changedFiles asks git for the files in dir that differ from the ref, including
+// the uncommitted changes and the untracked files that are not ignored, and
+// returns their absolute paths.
+func changedFiles(dir, ref string) ([]string, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	check := exec.Command("git", "rev-parse", "--is-inside-work-tree")
+	check.Dir = absDir
+
+	if err := check.Run(); err != nil {
+		return nil, errNotGitRepo
+	}
+
+	changed, err := gitFiles(absDir, "diff", "--name-only", "--relative", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	// A new file is not known to git diff until it is added to the index, while
+	// it is the most likely one to have new annotations.
+	untracked, err := gitFiles(absDir, "ls-files", "--others", "--exclude-standard", "-z", "--")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(changed, untracked...), nil
+}
+
+// gitFiles runs the git command listing the files relative to dir, separated
+// by NUL bytes, and returns their absolute paths.
+func gitFiles(dir string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return nil, err
+	}
+
+	files := []string{}
+
+	for _, name := range bytes.Split(output, []byte{0}) {
+		if len(name) > 0 {
+			files = append(files, filepath.Join(dir, filepath.FromSlash(string(name))))
+		}
+	}
+
+	return files, nil
+}
+
+// gitRoot returns the top-level directory of the git repository containing dir,
+// which the paths in the output of git diff are relative to.
+func gitRoot(dir string) (string, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errNotGitRepo
+	}
+
+	return filepath.FromSlash(strings.TrimSpace(string(output))), nil
+}
+
+// changedPackageFiles returns the files changed since the ref in any of the
+// packages. The list is empty rather than nil if none of them changed.
+func changedPackageFiles(pkgs []string, ref string) ([]string, error) {
+	files := []string{}
+
+	for _, pkg := range pkgs {
+		pkgFiles, err := changedFiles(pkg, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, pkgFiles...)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"old.go":    "package main\n\nvar a = new(int) //no-escape\n",
+		"new.go":    "package main\n\nvar b = 1\n",
+		"build.log": "./old.go:3:13: new(int) escapes to heap\n./new.go:3:13: new(int) escapes to heap\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	reportFile := filepath.Join(t.TempDir(), "report.txt")
+	args := []string{"-pkg", tmpDir, "-f", filepath.Join(tmpDir, "build.log"), "-o", reportFile, "-since", "HEAD"}
+
+	check := func(t *testing.T, expected, unexpected string) {
+		opts, err := parseOptions(args)
+		if err != nil {
+			t.Fatalf("parseOptions failed: %v", err)
+		}
+
+		if code := run(opts); code != exitFailure {
+			t.Errorf("expected exit code %d, got %d", exitFailure, code)
+		}
+
+		report, err := os.ReadFile(reportFile)
+		if err != nil {
+			t.Fatalf("failed to read report: %v", err)
+		}
+
+		if !strings.Contains(string(report), expected) || unexpected != "" && strings.Contains(string(report), unexpected) {
+			t.Errorf("expected a finding in %s only, got:\n%s", expected, report)
+		}
+	}
+
+	// Outside of a git repository, all files are checked.
+	t.Run("not a repository", func(t *testing.T) {
+		check(t, "old.go:3", "")
+	})
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = tmpDir
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "new.go"), []byte("package main\n\nvar b = new(int) //no-escape\n"), 0644); err != nil {
+		t.Fatalf("failed to write new.go: %v", err)
+	}
+
+	// Only the uncommitted change is checked.
+	t.Run("repository", func(t *testing.T) {
+		check(t, "new.go:3", "old.go")
+	})
+
+	git("commit", "-q", "-a", "-m", "change")
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "added.go"), []byte("package main\n\nvar c = new(int) //no-escape\n"), 0644); err != nil {
+		t.Fatalf("failed to write added.go: %v", err)
+	}
+
+	files["build.log"] += "./added.go:3:13: new(int) escapes to heap\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "build.log"), []byte(files["build.log"]), 0644); err != nil {
+		t.Fatalf("failed to write build.log: %v", err)
+	}
+
+	// A new file is checked before it is added to the index.
+	t.Run("untracked", func(t *testing.T) {
+		check(t, "added.go:3", "new.go")
+	})
+}
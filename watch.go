@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+// watchInterval is how often the source files are checked for changes. A change
+// is only acted upon once the files stay the same for another interval, since
+// editors and formatters often save a file in several steps.
+const watchInterval = 500 * time.Millisecond
+
+// watch checks the annotations every time a Go file in the package changes,
+// until the context is canceled.
+func watch(ctx context.Context, opts Options) {
+	log.Printf("watching %s for changes, press Ctrl+C to stop", strings.Join(opts.Pkg, ", "))
+
+	annotationOpts := opts.annotationOptions()
+
+	snapshot := snapshotPackages(opts.Pkg, annotationOpts)
+	pending := true
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		current := snapshotPackages(opts.Pkg, annotationOpts)
+
+		switch {
+		case !maps.Equal(current, snapshot):
+			snapshot = current
+			pending = true
+		case pending:
+			pending = false
+			run(opts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshotPackages returns the modification times of the Go files in all the
+// packages.
+func snapshotPackages(packagePaths []string, opts escapelint.AnnotationOptions) map[string]int64 {
+	files := make(map[string]int64)
+
+	for _, packagePath := range packagePaths {
+		maps.Copy(files, snapshotFiles(packagePath, opts))
+	}
+
+	return files
+}
+
+// snapshotFiles returns the modification times of the Go files in the package,
+// the same ones that are checked in a run. The walk stopping halfway, e.g. at
+// a file removed meanwhile, only makes the snapshot differ until the next one.
+func snapshotFiles(packagePath string, opts escapelint.AnnotationOptions) map[string]int64 {
+	files := make(map[string]int64)
+
+	_ = escapelint.WalkGoFiles(packagePath, opts, func(path string) error {
+		// The files reached through symbolic links change along with their
+		// targets rather than the links.
+		if info, err := os.Stat(path); err == nil {
+			files[path] = info.ModTime().UnixNano()
+		}
+
+		return nil
+	})
+
+	return files
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxpoletaev/go-escape-lint/escapelint"
+)
+
+func TestSnapshotFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, name := range []string{"main.go", "notes.txt", ".git/hooks.go", "vendor/dep.go"} {
+		filePath := filepath.Join(tmpDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(filePath, []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	opts := escapelint.DefaultAnnotationOptions()
+
+	before := snapshotFiles(tmpDir, opts)
+	if _, ok := before[filepath.Join(tmpDir, "main.go")]; !ok || len(before) != 1 {
+		t.Fatalf("expected only main.go in the snapshot, got %v", before)
+	}
+
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(tmpDir, "main.go"), mtime, mtime); err != nil {
+		t.Fatalf("failed to change modification time: %v", err)
+	}
+
+	if after := snapshotFiles(tmpDir, opts); maps.Equal(before, after) {
+		t.Errorf("expected the modification to change the snapshot")
+	}
+}
+
+func TestSnapshotFilesSymlinks(t *testing.T) {
+	tmpDir, targetDir := t.TempDir(), t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(targetDir, "hot.go"), []byte("package hot\n"), 0644); err != nil {
+		t.Fatalf("failed to write hot.go: %v", err)
+	}
+
+	if err := os.Symlink(targetDir, filepath.Join(tmpDir, "hot")); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+
+	// The linked package is watched only if a run checks it too.
+	linked := filepath.Join(tmpDir, "hot", "hot.go")
+	opts := escapelint.DefaultAnnotationOptions()
+
+	if _, ok := snapshotFiles(tmpDir, opts)[linked]; ok {
+		t.Errorf("expected %s to be left out without following symbolic links", linked)
+	}
+
+	opts.FollowSymlinks = true
+
+	if _, ok := snapshotFiles(tmpDir, opts)[linked]; !ok {
+		t.Errorf("expected %s in the snapshot when following symbolic links", linked)
+	}
+}